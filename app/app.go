@@ -2,6 +2,7 @@
 package app
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -9,47 +10,112 @@ import (
 	"os"
 	"path/filepath"
 	"rentiga-device/certificate"
+	"rentiga-device/config"
 	"rentiga-device/interfaces"
 	"rentiga-device/models"
 	"rentiga-device/rabbitmq"
 	"rentiga-device/streaming"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type App struct {
 	certManager   *certificate.Manager
-	streamer      *streaming.Streamer
+	main          *streamUnit   // stream из конфига
+	extra         []*streamUnit // streams из конфига, в том же порядке
+	recorder      *streaming.Recorder
+	preview       *streaming.Previewer
+	network       *streaming.NetworkOutput
+	audio         *streaming.AudioPassthrough
 	config        *models.AppConfig
 	stopHeartbeat chan struct{}
+	stopEvents    chan struct{} // под mu
 	rabbitClient  *rabbitmq.Client
-	isStreaming   bool
 	isConnected   bool
 	mu            sync.Mutex
+
+	sessionMu     sync.Mutex
+	session       *models.SessionInfo
+	sessionTimer  *time.Timer
+	sessionEnd    atomic.Int64 // UnixNano окончания сеанса для плашки, без блокировок
+
+	consumerMu    sync.Mutex
+	commandQueue  rabbitmq.Binding
+
+	snapshotMu    sync.Mutex
+	lastSnapshot  *models.SnapshotInfo
+
+	// cfgMu защищает поля config, которые меняются при горячей перезагрузке
+	cfgMu          sync.RWMutex
+	configReloaded time.Time
+	configPending  []string
+	configError    string
+	overrides      runtimeOverrides
 }
 
 var _ interfaces.Application = (*App)(nil)
 
 func New(cfg *models.AppConfig, rabbit *rabbitmq.Client) *App {
-	return &App{
+	a := &App{
 		certManager:  certificate.NewManager(&cfg.Certificate),
-		streamer:     streaming.NewStreamer(&cfg.Stream, cfg.Certificate.DeviceID),
+		main:         newStreamUnit(config.DefaultStream, cfg.Stream, cfg.Certificate.DeviceID),
 		config:       cfg,
 		rabbitClient: rabbit,
 	}
+	a.recorder = streaming.NewRecorder(cfg.Stream.Recording, a.main.streamer.Tap)
+	a.preview = streaming.NewPreviewer(cfg.Stream.Preview, a.main.streamer)
+	a.network = streaming.NewNetworkOutput(cfg.Stream.Network, a.main.streamer.Tap)
+	a.audio = streaming.NewAudioPassthrough(cfg.Stream.Audio)
+	a.main.streamer.OnEvent = a.onStreamEvent
+	for i := range cfg.Streams {
+		u := newStreamUnit(cfg.Streams[i].Name, cfg.Streams[i], cfg.Certificate.DeviceID)
+		u.streamer.OnEvent = a.onUnitEvent(u)
+		a.extra = append(a.extra, u)
+	}
+	for _, u := range a.units() {
+		u.streamer.Overlay().Remaining = a.sessionRemaining
+	}
+	return a
 }
 
 func (a *App) Initialize() {
 	if a.hasSavedCertificate() {
 		if err := a.loadSavedCertificate(); err == nil {
 			log.Println("Loaded saved certificate successfully")
+			a.emitEvent(EventCertificateLoaded, map[string]interface{}{"source": "saved"})
 			a.checkConnection()
 		}
 	}
+	for _, u := range a.units() {
+		u.idle.SetDeviceID(a.certManager.Config().DeviceID)
+	}
+
+	a.restoreSession()
+	if !a.IsStreaming() {
+		a.showIdle(a.main)
+	}
+	for _, u := range a.extra {
+		a.showIdle(u)
+	}
+
+	if a.config.Stream.Recording.AutoStart {
+		if err := a.StartRecording(""); err != nil {
+			log.Printf("Failed to start recording: %v", err)
+		}
+	}
+	a.applyNetworkConfig()
 }
 
+// GetConfig возвращает копию текущей конфигурации: оригинал меняется при перезагрузке.
 func (a *App) GetConfig() interface{} {
-	return a.config
+	a.cfgMu.RLock()
+	defer a.cfgMu.RUnlock()
+
+	cfg := *a.config
+	cfg.Streams = append([]models.StreamConfig(nil), a.config.Streams...)
+	return &cfg
 }
 
 func (a *App) HasCertificate() bool {
@@ -82,7 +148,15 @@ func (a *App) LoadCertificate(zipPath string) error {
         log.Printf("Failed to save certificate: %v", err)
     }
     
+    a.emitEvent(EventCertificateLoaded, map[string]interface{}{"source": "upload"})
+    for _, u := range a.units() {
+        u.idle.SetDeviceID(a.certManager.Config().DeviceID)
+    }
     a.checkConnection()
+
+    if err := a.subscribeCommands(); err != nil {
+        log.Printf("Failed to subscribe to device commands: %v", err)
+    }
     return nil
 }
 
@@ -92,7 +166,7 @@ func (a *App) checkConnection() {
 		return
 	}
 
-	url := fmt.Sprintf("https://localhost:8443/tls/devices/%s/login", deviceID)
+	url := a.backendURL("/tls/devices/%s/login", deviceID)
 	req, err := http.NewRequest("POST", url, nil)
 	if err != nil {
 		return
@@ -107,7 +181,7 @@ func (a *App) checkConnection() {
 
 	switch {
 	case resp.StatusCode == http.StatusOK:
-		a.isConnected = true;
+		a.setConnected(true)
 		go a.startHeartbeat()
 
 	case resp.StatusCode == http.StatusUnauthorized:
@@ -117,11 +191,20 @@ func (a *App) checkConnection() {
 	}
 }
 
+func (a *App) backendURL(format string, args ...interface{}) string {
+	a.cfgMu.RLock()
+	base := a.config.Backend.BaseURL
+	a.cfgMu.RUnlock()
+
+	return strings.TrimRight(base, "/") + fmt.Sprintf(format, args...)
+}
+
 func (a *App) startHeartbeat() {
 	if a.stopHeartbeat != nil {
 		close(a.stopHeartbeat)
 	}
 	a.stopHeartbeat = make(chan struct{})
+	stop := a.stopHeartbeat
 
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
@@ -130,7 +213,7 @@ func (a *App) startHeartbeat() {
 		select {
 		case <-ticker.C:
 			a.sendHeartbeat()
-		case <-a.stopHeartbeat:
+		case <-stop:
 			return
 		}
 	}
@@ -138,90 +221,112 @@ func (a *App) startHeartbeat() {
 
 func (a *App) sendHeartbeat() {
 	deviceID := a.certManager.Config().DeviceID
-	url := fmt.Sprintf("https://localhost:8443/tls/devices/%s/heartbeat", deviceID)
+	url := a.backendURL("/tls/devices/%s/heartbeat", deviceID)
 
-	req, err := http.NewRequest("POST", url, nil)
+	body, err := json.Marshal(a.heartbeatPayload())
 	if err != nil {
 		log.Println("Heartbeat error:", err)
 		return
 	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		log.Println("Heartbeat error:", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := a.certManager.HTTPClient().Do(req)
 	if err != nil {
-		a.isConnected = false;
+		a.setConnected(false)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
 		log.Println("Unexpected heartbeat status:", resp.Status)
+		return
 	}
+	a.setConnected(true)
+}
+
+// heartbeatPayload - краткое состояние для бэкенда: идет ли поток и его показатели.
+func (a *App) heartbeatPayload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"streaming": a.IsStreaming(),
+	}
+	if metrics, ok := a.main.streamer.Metrics(); ok {
+		payload["pipeline"] = metrics
+	}
+	return payload
 }
 
 func (a *App) StartStream() {
+    if err := a.startStream(); err != nil {
+        log.Printf("Stream start error: %v", err)
+    }
+}
+
+func (a *App) startStream() error {
     a.mu.Lock()
     defer a.mu.Unlock()
     
-    if a.isStreaming {
-        return
+    if a.main.isStreaming {
+        return nil
     }
     
-    if err := a.streamer.Start(); err != nil {
-        log.Printf("Stream start error: %v", err)
-        return
+    // превью без трансляции читает то же устройство
+    a.preview.ReleaseDevice()
+    defer a.preview.ReturnDevice()
+    if err := a.startUnit(a.main); err != nil {
+        return err
     }
-    
-    a.isStreaming = true
+    a.startAudio()
+    return nil
+}
+
+func (a *App) IsStreaming() bool {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    return a.main.isStreaming
 }
 
 func (a *App) StopStream() {
     a.mu.Lock()
     defer a.mu.Unlock()
     
-    if !a.isStreaming {
+    if !a.main.isStreaming {
         return
     }
     
-    a.streamer.Stop()
-    a.isStreaming = false
-}
-
-func (a *App) StartCommandConsumer() {
-    msgs, err := a.rabbitClient.Consume("stream_commands")
-    if err != nil {
-        log.Fatalf("Failed to start consumer: %v", err)
-    }
-
-    go func() {
-        for msg := range msgs {
-            var cmd models.CommandMessage
-            if err := json.Unmarshal(msg.Body, &cmd); err != nil {
-                log.Printf("Failed to parse command: %v", err)
-                continue
-            }
-
-            if cmd.DeviceID != a.certManager.Config().DeviceID {
-                continue
-            }
-
-            // Убрали glib.IdleAdd
-            switch cmd.Action {
-            case "start":
-                a.StartStream()
-            case "stop":
-                a.StopStream()
-            default:
-                log.Printf("Unknown command action: %s", cmd.Action)
-            }
-        }
-    }()
+    a.audio.Stop()
+    a.recorder.Detach()
+    a.stopUnit(a.main)
 }
 
 func (a *App) GetStatus() map[string]interface{} {
-    return map[string]interface{}{
-        "streaming":  a.isStreaming,
-        "connected":  a.isConnected,
+    a.mu.Lock()
+    streaming, connected := a.main.isStreaming, a.isConnected
+    a.mu.Unlock()
+
+    status := map[string]interface{}{
+        "streaming":  streaming,
+        "connected":  connected,
+        "broker":     a.rabbitClient.Status(),
         "device_id":  a.certManager.Config().DeviceID,
 		"has_certificate": a.HasCertificate(),
+		"config":          a.configStatus(),
+		"session":         a.Session(),
+		"idle_screen":     a.main.idle.Visible(),
+		"pipeline":        a.main.streamer.Status(),
+		"last_snapshot":   a.LastSnapshot(),
+		"recording":       a.recorder.Status(),
+		"preview_viewers": a.preview.Viewers(),
+		"network":         a.network.Status(),
+		"audio":           a.audio.Status(),
+    }
+    if extra := a.extraStatus(); extra != nil {
+        status["streams"] = extra
     }
+    return status
 }
\ No newline at end of file
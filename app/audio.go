@@ -0,0 +1,69 @@
+package app
+
+import (
+	"rentiga-device/models"
+	"rentiga-device/streaming"
+)
+
+// startAudio включает звук вместе с потоком, если он разрешен в конфиге.
+func (a *App) startAudio() {
+	a.cfgMu.RLock()
+	enabled, device := a.config.Stream.Audio.Enabled, a.config.Stream.Device
+	a.cfgMu.RUnlock()
+
+	if enabled {
+		a.audio.Start(device)
+	}
+}
+
+// UpdateAudio меняет громкость, mute или включает звук без перезапуска видео.
+// Изменение переживает перезагрузку конфигурации, но не перезапуск агента.
+func (a *App) UpdateAudio(u models.AudioUpdate) error {
+	a.cfgMu.RLock()
+	cfg := a.config.Stream.Audio
+	a.cfgMu.RUnlock()
+
+	if u.Enabled != nil {
+		cfg.Enabled = *u.Enabled
+	}
+	if u.Volume != nil {
+		cfg.Volume = *u.Volume
+	}
+	if u.Mute != nil {
+		cfg.Mute = *u.Mute
+	}
+	if err := streaming.ValidateAudio(cfg); err != nil {
+		return err
+	}
+	a.cfgMu.Lock()
+	a.overrides.setAudio(u)
+	a.cfgMu.Unlock()
+	a.setAudioConfig(cfg)
+	return nil
+}
+
+func (a *App) setAudioConfig(cfg models.AudioConfig) {
+	a.cfgMu.Lock()
+	old := a.config.Stream.Audio
+	a.config.Stream.Audio = cfg
+	a.cfgMu.Unlock()
+	a.updateUnit(a.main)
+	a.audio.Update(cfg)
+
+	if !cfg.Enabled {
+		a.audio.Stop()
+		return
+	}
+	if !a.IsStreaming() {
+		return
+	}
+	a.startAudio()
+	if old.Enabled && old != cfg {
+		// процесс уже идет со старыми настройками
+		a.audio.Restart()
+	}
+}
+
+func (a *App) AudioStatus() map[string]interface{} {
+	return a.audio.Status()
+}
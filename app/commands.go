@@ -0,0 +1,245 @@
+// app/commands.go
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"rentiga-device/config"
+	"rentiga-device/models"
+	"rentiga-device/rabbitmq"
+
+	"github.com/streadway/amqp"
+)
+
+// permanentError - команда, которую бессмысленно повторять (битый JSON, неизвестное
+// действие). Такие сообщения уходят в dead-letter exchange, остальные ошибки
+// считаются временными и возвращаются в очередь.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return &permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// StartCommandConsumer подписывается на персональную очередь команд устройства.
+// Без сертификата DeviceID неизвестен, и подписка откладывается до LoadCertificate.
+// rabbitmq.Client сам восстанавливает подписку после обрыва связи с брокером.
+func (a *App) StartCommandConsumer() {
+	if a.certManager.Config().DeviceID == "" {
+		log.Println("No certificate loaded, command consumer will start after certificate upload")
+		return
+	}
+
+	if err := a.subscribeCommands(); err != nil {
+		log.Fatalf("Failed to start consumer: %v", err)
+	}
+}
+
+// subscribeCommands (пере)подписывается на очередь команд, если сменился DeviceID
+// или настройки exchange. Повторный вызов с теми же параметрами ничего не делает.
+func (a *App) subscribeCommands() error {
+	deviceID := a.certManager.Config().DeviceID
+	if deviceID == "" {
+		return nil
+	}
+
+	a.cfgMu.RLock()
+	binding := rabbitmq.DeviceCommandBinding(a.config.Broker.CommandExchange, deviceID)
+	binding.ManualAck = true
+	binding.DeadLetterExchange = a.config.Broker.DeadLetterExchange
+	a.cfgMu.RUnlock()
+
+	a.consumerMu.Lock()
+	defer a.consumerMu.Unlock()
+
+	if binding == a.commandQueue {
+		return nil
+	}
+
+	if a.commandQueue.Queue != "" {
+		if err := a.rabbitClient.Unsubscribe(a.commandQueue.Queue); err != nil {
+			log.Printf("Failed to unsubscribe from %s: %v", a.commandQueue.Queue, err)
+		}
+	}
+
+	msgs, err := a.rabbitClient.ConsumeBinding(binding)
+	if err != nil {
+		return err
+	}
+	a.commandQueue = binding
+	log.Printf("Consuming commands from %s (exchange %s, key %s)", binding.Queue, binding.Exchange, binding.RoutingKey)
+
+	go func() {
+		for msg := range msgs {
+			a.processDelivery(msg, deviceID, binding.DeadLetterExchange)
+		}
+	}()
+	return nil
+}
+
+// processDelivery подтверждает команду только после ее выполнения. Временная ошибка
+// возвращает сообщение в очередь один раз, повторная неудача - dead-letter.
+// Ответ в ReplyTo отправляется только с окончательным результатом, до ack.
+func (a *App) processDelivery(msg amqp.Delivery, deviceID, dlx string) {
+	cmd, err := a.dispatchCommand(msg.Body, deviceID)
+
+	switch {
+	case err == nil:
+		a.reply(msg, cmd, nil)
+		if ackErr := msg.Ack(false); ackErr != nil {
+			log.Printf("Failed to ack command: %v", ackErr)
+		}
+	case isPermanent(err):
+		log.Printf("Rejecting command: %v", err)
+		a.reply(msg, cmd, err)
+		a.deadLetter(msg, dlx, err.Error())
+	case msg.Redelivered:
+		log.Printf("Command failed again, rejecting: %v", err)
+		a.reply(msg, cmd, err)
+		a.deadLetter(msg, dlx, "retry failed: "+err.Error())
+	default:
+		log.Printf("Command failed, requeueing: %v", err)
+		if nackErr := msg.Nack(false, true); nackErr != nil {
+			log.Printf("Failed to nack command: %v", nackErr)
+		}
+	}
+}
+
+func (a *App) reply(msg amqp.Delivery, cmd models.CommandMessage, cmdErr error) {
+	if msg.ReplyTo == "" {
+		return
+	}
+
+	result := models.CommandResult{
+		DeviceID:  a.certManager.Config().DeviceID,
+		Action:    cmd.Action,
+		Status:    "ok",
+		Streaming: a.IsStreaming(),
+		Timestamp: time.Now().UTC(),
+		Session:   a.Session(),
+	}
+	if cmdErr != nil {
+		result.Status = "error"
+		result.Error = cmdErr.Error()
+	}
+	if cmd.Action == "snapshot" {
+		result.Snapshot = a.LastSnapshot()
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Failed to encode command result: %v", err)
+		return
+	}
+	if err := a.rabbitClient.Reply(msg.ReplyTo, msg.CorrelationId, body); err != nil {
+		log.Printf("Failed to reply to %s: %v", msg.ReplyTo, err)
+	}
+}
+
+func (a *App) deadLetter(msg amqp.Delivery, dlx, reason string) {
+	if err := a.rabbitClient.DeadLetter(msg, dlx, reason); err != nil {
+		log.Printf("Failed to dead-letter command: %v", err)
+	}
+}
+
+func (a *App) dispatchCommand(body []byte, deviceID string) (models.CommandMessage, error) {
+	var cmd models.CommandMessage
+	if err := json.Unmarshal(body, &cmd); err != nil {
+		return cmd, permanent(fmt.Errorf("failed to parse command: %v", err))
+	}
+
+	// очередь персональная, но защищаемся от ошибочной маршрутизации
+	if cmd.DeviceID != "" && cmd.DeviceID != deviceID {
+		return cmd, permanent(fmt.Errorf("command for device %s routed to %s", cmd.DeviceID, deviceID))
+	}
+
+	return cmd, a.handleCommand(cmd)
+}
+
+func (a *App) handleCommand(cmd models.CommandMessage) error {
+	switch cmd.Action {
+	case "start_recording", "stop_recording", "overlay", "audio":
+		// без этой проверки команда для дополнительного потока изменила бы основной
+		if cmd.Stream != "" && cmd.Stream != config.DefaultStream {
+			return permanent(fmt.Errorf("%s is only supported for the %s stream, got %q", cmd.Action, config.DefaultStream, cmd.Stream))
+		}
+	}
+
+	switch cmd.Action {
+	case "start":
+		if _, err := a.stream(cmd.Stream); err != nil {
+			return permanent(err)
+		}
+		return a.StartStreamByName(cmd.Stream)
+	case "stop", "end_session":
+		u, err := a.stream(cmd.Stream)
+		if err != nil {
+			return permanent(err)
+		}
+		if u != a.main {
+			// сеанс привязан к основному потоку, дополнительный просто останавливается
+			return a.StopStreamByName(cmd.Stream)
+		}
+		a.endSession(EventSessionEnded)
+		a.StopStream()
+		return nil
+	case "start_session":
+		return a.startSession(cmd)
+	case "extend_session":
+		return a.extendSession(cmd)
+	case "snapshot":
+		// по брокеру картинку не вернуть - снимок всегда уходит на бэкенд
+		if _, err := a.stream(cmd.Stream); err != nil {
+			return permanent(err)
+		}
+		_, err := a.TakeSnapshot(cmd.Stream, true)
+		return err
+	case "start_recording":
+		if a.recorder.Recording() {
+			return nil
+		}
+		return a.StartRecording(cmd.SessionID)
+	case "stop_recording":
+		a.StopRecording()
+		return nil
+	case "overlay":
+		if cmd.Overlay == nil {
+			return permanent(errors.New("overlay parameters are required"))
+		}
+		if err := a.UpdateOverlay(*cmd.Overlay); err != nil {
+			return permanent(err)
+		}
+		return nil
+	case "audio":
+		if cmd.Audio == nil {
+			return permanent(errors.New("audio parameters are required"))
+		}
+		if err := a.UpdateAudio(*cmd.Audio); err != nil {
+			return permanent(err)
+		}
+		return nil
+	case "transform":
+		if cmd.Transform == nil {
+			return permanent(errors.New("transform parameters are required"))
+		}
+		if err := a.SetTransform(cmd.Stream, *cmd.Transform); err != nil {
+			return permanent(err)
+		}
+		return nil
+	default:
+		return permanent(fmt.Errorf("unknown command action: %q", cmd.Action))
+	}
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"io"
+
+	"rentiga-device/streaming"
+)
+
+// VideoDevices перечисляет устройства захвата и отмечает настроенное.
+func (a *App) VideoDevices() (map[string]interface{}, error) {
+	devices, err := streaming.ListVideoDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	a.cfgMu.RLock()
+	stream := a.config.Stream
+	a.cfgMu.RUnlock()
+
+	return map[string]interface{}{
+		"devices":    devices,
+		"configured": stream.Device,
+		"resolution": stream.Resolution,
+		"framerate":  stream.Framerate,
+	}, nil
+}
+
+// Displays перечисляет DRM-коннекторы и показывает, какой из них выбран в конфиге.
+func (a *App) Displays() (map[string]interface{}, error) {
+	connectors, err := streaming.ListConnectors()
+	if err != nil {
+		return nil, err
+	}
+
+	a.cfgMu.RLock()
+	stream := a.config.Stream
+	a.cfgMu.RUnlock()
+
+	result := map[string]interface{}{
+		"connectors":   connectors,
+		"connector":    stream.Connector,
+		"connector_id": stream.ConnectorID,
+	}
+	if id, err := streaming.ResolveConnector(&stream); err != nil {
+		result["error"] = err.Error()
+	} else {
+		result["resolved_id"] = id
+	}
+	return result, nil
+}
+
+// ServePreview пишет MJPEG-превью в w до отключения зрителя.
+func (a *App) ServePreview(ctx context.Context, w io.Writer) error {
+	return a.preview.Serve(ctx, w)
+}
+
+// PipelineMetrics возвращает показатели работающего пайплайна потока; ok=false,
+// если поток не идет или такого потока нет.
+func (a *App) PipelineMetrics(stream string) (streaming.PipelineMetrics, bool) {
+	u, err := a.stream(stream)
+	if err != nil {
+		return streaming.PipelineMetrics{}, false
+	}
+	return u.streamer.Metrics()
+}
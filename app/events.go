@@ -0,0 +1,156 @@
+// app/events.go
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"rentiga-device/models"
+	"rentiga-device/rabbitmq"
+	"rentiga-device/streaming"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	EventStreamStarted       = "stream_started"
+	EventStreamStopped       = "stream_stopped"
+	EventStreamCrashed       = streaming.EventCrashed
+	EventStreamRestarted     = streaming.EventRestarted
+	EventStreamFailed        = streaming.EventFailed
+	EventSourceLost          = streaming.EventSourceLost
+	EventSourceRestored      = streaming.EventSourceRestored
+	EventCertificateLoaded   = "certificate_loaded"
+	EventBackendConnected    = "backend_connected"
+	EventBackendDisconnected = "backend_disconnected"
+	EventStatus              = "status"
+)
+
+// emitEvent публикует событие в exchange событий. Пока брокер недоступен, события
+// теряются: актуальное состояние все равно придет со следующим снимком статуса.
+func (a *App) emitEvent(eventType string, data map[string]interface{}) {
+	deviceID := a.certManager.Config().DeviceID
+	if deviceID == "" {
+		return
+	}
+
+	routingKey := fmt.Sprintf("device.%s.event.%s", deviceID, eventType)
+	if eventType == EventStatus {
+		routingKey = fmt.Sprintf("device.%s.status", deviceID)
+	}
+
+	body, err := json.Marshal(models.DeviceEvent{
+		DeviceID:  deviceID,
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	a.cfgMu.RLock()
+	exchange := a.config.Broker.EventExchange
+	a.cfgMu.RUnlock()
+
+	err = a.rabbitClient.PublishExchange(exchange, amqp.ExchangeTopic, routingKey, body)
+	if err != nil && !errors.Is(err, rabbitmq.ErrNotConnected) {
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// statusIdlePoll - как часто проверять интервал, пока публикация статуса выключена.
+const statusIdlePoll = 30 * time.Second
+
+// StartEventPublisher периодически публикует снимок GetStatus до StopEventPublisher.
+func (a *App) StartEventPublisher() {
+	a.mu.Lock()
+	if a.stopEvents != nil {
+		close(a.stopEvents)
+	}
+	a.stopEvents = make(chan struct{})
+	stop := a.stopEvents
+	a.mu.Unlock()
+
+	go func() {
+		interval := a.statusInterval()
+		ticker := time.NewTicker(statusTick(interval))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+			if interval > 0 {
+				a.emitEvent(EventStatus, a.GetStatus())
+			}
+			// интервал может поменяться при перезагрузке конфига
+			if next := a.statusInterval(); next != interval {
+				interval = next
+				ticker.Reset(statusTick(interval))
+			}
+		}
+	}()
+}
+
+func (a *App) StopEventPublisher() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stopEvents != nil {
+		close(a.stopEvents)
+		a.stopEvents = nil
+	}
+}
+
+// statusInterval - период публикации статуса; 0 - публикация выключена.
+func (a *App) statusInterval() time.Duration {
+	a.cfgMu.RLock()
+	defer a.cfgMu.RUnlock()
+
+	return time.Duration(a.config.Broker.StatusInterval) * time.Second
+}
+
+func statusTick(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return statusIdlePoll
+	}
+	return interval
+}
+
+// onStreamEvent получает события супервизора пайплайна. Пока идут перезапуски,
+// поток считается запущенным; только после отказа супервизора показываем заставку.
+// Пока нет устройства захвата, заставка тоже на экране.
+func (a *App) onStreamEvent(event string, data map[string]interface{}) {
+	if event == streaming.EventFailed {
+		a.mu.Lock()
+		a.main.isStreaming = false
+		a.audio.Stop()
+		a.showIdle(a.main)
+		a.mu.Unlock()
+	}
+	a.onSourceEvent(a.main, event)
+	a.emitEvent(event, data)
+}
+
+func (a *App) setConnected(connected bool) {
+	a.mu.Lock()
+	changed := a.isConnected != connected
+	a.isConnected = connected
+	a.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if connected {
+		a.emitEvent(EventBackendConnected, nil)
+	} else {
+		a.emitEvent(EventBackendDisconnected, nil)
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"log"
+
+	"rentiga-device/models"
+)
+
+// applyNetworkConfig включает сетевой вывод, если он разрешен в конфиге. Процесс
+// дождется отвода кадров сам, поэтому порядок относительно запуска потока не важен.
+func (a *App) applyNetworkConfig() {
+	a.cfgMu.RLock()
+	enabled := a.config.Stream.Network.Enabled
+	a.cfgMu.RUnlock()
+
+	if !enabled {
+		return
+	}
+	if err := a.network.Start(); err != nil {
+		log.Printf("Failed to start network output: %v", err)
+	}
+}
+
+// setNetworkConfig применяет новые настройки сетевого вывода без перезапуска видео:
+// процесс вывода перезапускается, если он уже шел.
+func (a *App) setNetworkConfig(cfg models.NetworkConfig) {
+	a.cfgMu.Lock()
+	old := a.config.Stream.Network
+	a.config.Stream.Network = cfg
+	a.cfgMu.Unlock()
+	a.updateUnit(a.main)
+
+	if old.Enabled && old != cfg {
+		a.network.Stop()
+	}
+	a.network.Update(cfg)
+	a.applyNetworkConfig()
+}
+
+func (a *App) NetworkStatus() map[string]interface{} {
+	return a.network.Status()
+}
+
+// HLSFile возвращает путь к плейлисту или сегменту HLS для веб-сервера.
+func (a *App) HLSFile(name string) (string, error) {
+	return a.network.HLSFile(name)
+}
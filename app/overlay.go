@@ -0,0 +1,57 @@
+// app/overlay.go
+package app
+
+import (
+	"rentiga-device/models"
+)
+
+// OverlayConfig возвращает текущие настройки плашки.
+func (a *App) OverlayConfig() models.OverlayConfig {
+	return a.main.streamer.Overlay().Config()
+}
+
+// UpdateOverlay меняет текст и режим плашки без перезапуска пайплайна.
+// Включение или выключение плашки меняет состав пайплайна и перезапускает его.
+// Изменение переживает перезагрузку конфигурации, но не перезапуск агента.
+func (a *App) UpdateOverlay(u models.OverlayUpdate) error {
+	cfg := a.main.streamer.Overlay().Config()
+	if u.Mode != nil {
+		cfg.Mode = *u.Mode
+	}
+	if u.Message != nil {
+		cfg.Message = *u.Message
+	}
+	if u.Enabled != nil {
+		cfg.Enabled = *u.Enabled
+	}
+	if err := a.setOverlay(cfg); err != nil {
+		return err
+	}
+	a.cfgMu.Lock()
+	a.overrides.setOverlay(u)
+	a.cfgMu.Unlock()
+	return nil
+}
+
+func (a *App) setOverlay(cfg models.OverlayConfig) error {
+	if err := a.main.streamer.Overlay().Update(cfg); err != nil {
+		return err
+	}
+
+	a.cfgMu.RLock()
+	toggled := a.config.Stream.Overlay.Enabled != cfg.Enabled
+	stream := a.config.Stream
+	a.cfgMu.RUnlock()
+
+	if !toggled {
+		a.cfgMu.Lock()
+		a.config.Stream.Overlay = cfg
+		a.cfgMu.Unlock()
+		a.updateUnit(a.main)
+		return nil
+	}
+
+	stream.Overlay = cfg
+	a.applyStreamConfig(stream)
+	return nil
+}
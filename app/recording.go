@@ -0,0 +1,53 @@
+package app
+
+import (
+	"log"
+
+	"rentiga-device/models"
+)
+
+const (
+	EventRecordingStarted = "recording_started"
+	EventRecordingStopped = "recording_stopped"
+)
+
+// StartRecording включает запись независимо от вывода на экран. Без явной метки
+// файлы помечаются ID текущего сеанса аренды.
+func (a *App) StartRecording(label string) error {
+	if label == "" {
+		if s := a.Session(); s != nil {
+			label = s.ID
+		}
+	}
+	if err := a.recorder.Start(label); err != nil {
+		return err
+	}
+	log.Printf("Recording started (label %q)", label)
+	a.emitEvent(EventRecordingStarted, map[string]interface{}{"label": label})
+	return nil
+}
+
+func (a *App) StopRecording() {
+	if !a.recorder.Recording() {
+		return
+	}
+	a.recorder.Stop()
+	log.Println("Recording stopped")
+	a.emitEvent(EventRecordingStopped, a.recorder.Status())
+}
+
+func (a *App) RecordingStatus() map[string]interface{} {
+	return a.recorder.Status()
+}
+
+// setRecordingConfig применяет новые настройки записи; идущая запись продолжается с ними.
+func (a *App) setRecordingConfig(cfg models.RecordingConfig) {
+	a.cfgMu.Lock()
+	a.config.Stream.Recording = cfg
+	a.cfgMu.Unlock()
+	a.updateUnit(a.main)
+
+	if err := a.recorder.Update(cfg); err != nil {
+		a.SetConfigError(err)
+	}
+}
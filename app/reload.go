@@ -0,0 +1,335 @@
+// app/reload.go
+package app
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"rentiga-device/config"
+	"rentiga-device/models"
+)
+
+// ApplyConfig применяет перечитанную конфигурацию без перезапуска агента.
+// Изменения stream.* перезапускают пайплайн (кроме плашки, звука, записи и
+// сетевого вывода, которые меняются на лету), broker.uri - переподключает RabbitMQ,
+// exchange команд - переподписывает очередь, остальные broker.*, web.auth.* и
+// backend.* действуют со следующего запроса, streams.<имя>.* перезапускают
+// только этот поток. Остальное (пути сертификатов, порт веб-сервера, состав streams)
+// требует перезапуска и попадает в статус как pending_restart.
+func (a *App) ApplyConfig(cfg *models.AppConfig) {
+	a.cfgMu.Lock()
+	a.overrides.apply(cfg)
+	changed := config.Diff(a.config, cfg)
+
+	var restartStream, reconnect, resubscribe, overlay, audio, recording, network bool
+	var pending []string
+	units := make(map[string]bool) // дополнительный поток -> нужен ли перезапуск
+	for _, key := range changed {
+		switch {
+		case strings.HasPrefix(key, "stream.overlay.") && key != "stream.overlay.enabled":
+			// текст и оформление плашки меняются без перезапуска пайплайна
+			overlay = true
+		case strings.HasPrefix(key, "stream.audio."):
+			// звук - отдельный процесс, видео не перезапускается
+			audio = true
+		case strings.HasPrefix(key, "stream.recording."):
+			// запись читает отвод кадров, пайплайн ей перезапускать не нужно
+			recording = true
+		case strings.HasPrefix(key, "stream.network."):
+			// сетевой вывод тоже читает отвод и перезапускается отдельно
+			network = true
+		case strings.HasPrefix(key, "stream."):
+			restartStream = true
+		case strings.HasPrefix(key, "streams."):
+			name, field, _ := strings.Cut(strings.TrimPrefix(key, "streams."), ".")
+			units[name] = units[name] || unitNeedsRestart(field)
+		case key == "broker.uri":
+			reconnect = true
+		case key == "broker.command_exchange", key == "broker.dead_letter_exchange":
+			resubscribe = true
+		case strings.HasPrefix(key, "broker."):
+			// event_exchange и status_interval_sec читаются при каждой публикации
+		case strings.HasPrefix(key, "web.auth."), strings.HasPrefix(key, "backend."):
+		default:
+			pending = append(pending, key)
+		}
+	}
+
+	a.config.Web.Auth = cfg.Web.Auth
+	a.config.Backend = cfg.Backend
+	// адрес брокера меняется только после успешного переподключения
+	uri := a.config.Broker.URI
+	a.config.Broker = cfg.Broker
+	a.config.Broker.URI = uri
+	a.configReloaded = time.Now()
+	a.configPending = pending
+	a.configError = ""
+	a.cfgMu.Unlock()
+
+	if len(changed) == 0 {
+		return
+	}
+	log.Printf("Config changes: %s", strings.Join(changed, ", "))
+	if len(pending) > 0 {
+		log.Printf("Config changes require restart: %s", strings.Join(pending, ", "))
+	}
+
+	if restartStream {
+		a.applyStreamConfig(cfg.Stream)
+	}
+	for _, u := range a.extra {
+		if restart, ok := units[u.name]; ok {
+			a.applyUnitConfig(u, *streamByName(cfg, u.name), restart)
+		}
+	}
+	if overlay {
+		if err := a.setOverlay(cfg.Stream.Overlay); err != nil {
+			a.SetConfigError(err)
+		}
+	}
+	if audio {
+		a.setAudioConfig(cfg.Stream.Audio)
+	}
+	if recording && !restartStream {
+		a.setRecordingConfig(cfg.Stream.Recording)
+	}
+	if network && !restartStream {
+		a.setNetworkConfig(cfg.Stream.Network)
+	}
+
+	if reconnect {
+		if err := a.rabbitClient.Reconnect(cfg.Broker.URI); err != nil {
+			a.SetConfigError(err)
+			return
+		}
+		a.cfgMu.Lock()
+		a.config.Broker.URI = cfg.Broker.URI
+		a.cfgMu.Unlock()
+		log.Println("Reconnected to RabbitMQ with new broker settings")
+	}
+	if reconnect || resubscribe {
+		// потребители команд переподписываются внутри rabbitmq.Client,
+		// здесь нужно только учесть смену exchange команд
+		if err := a.subscribeCommands(); err != nil {
+			a.SetConfigError(err)
+		}
+	}
+}
+
+// unitNeedsRestart: плашка меняется на лету, а запись, превью, сетевой вывод
+// и звук дополнительным потокам не нужны - эти поля они лишь наследуют от stream.
+func unitNeedsRestart(field string) bool {
+	switch {
+	case strings.HasPrefix(field, "overlay.") && field != "overlay.enabled":
+		return false
+	case strings.HasPrefix(field, "recording."), strings.HasPrefix(field, "preview."),
+		strings.HasPrefix(field, "network."), strings.HasPrefix(field, "audio."):
+		return false
+	}
+	return true
+}
+
+func (a *App) applyStreamConfig(stream models.StreamConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.main.isStreaming {
+		a.recorder.Detach()
+		a.main.streamer.Stop()
+	}
+	a.network.Stop()
+	a.audio.Stop()
+	// заставку перерисовываем с новыми настройками
+	a.main.idle.Hide()
+
+	// streamer, заставка и превью держат свои копии конфига
+	a.cfgMu.Lock()
+	a.config.Stream = stream
+	a.cfgMu.Unlock()
+	a.updateUnit(a.main)
+	a.preview.Update(stream.Preview)
+	if err := a.main.streamer.Overlay().Update(stream.Overlay); err != nil {
+		log.Printf("Overlay config rejected: %v", err)
+	}
+	if err := a.recorder.Update(stream.Recording); err != nil {
+		log.Printf("Recording config rejected: %v", err)
+	}
+	a.network.Update(stream.Network)
+	a.audio.Update(stream.Audio)
+	a.applyNetworkConfig()
+
+	if !a.main.isStreaming {
+		a.showIdle(a.main)
+		return
+	}
+	a.preview.ReleaseDevice()
+	defer a.preview.ReturnDevice()
+	if err := a.main.streamer.Start(); err != nil {
+		log.Printf("Stream restart after config change failed: %v", err)
+		a.main.isStreaming = false
+		a.showIdle(a.main)
+		return
+	}
+	a.startAudio()
+	log.Println("Stream restarted with new config")
+}
+
+// SetConfigError сохраняет ошибку перезагрузки конфигурации для статуса.
+func (a *App) SetConfigError(err error) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
+
+	a.configError = err.Error()
+}
+
+// WebAuth возвращает актуальные учетные данные веб-интерфейса.
+func (a *App) WebAuth() models.WebAuthConfig {
+	a.cfgMu.RLock()
+	defer a.cfgMu.RUnlock()
+
+	return a.config.Web.Auth
+}
+
+func (a *App) configStatus() map[string]interface{} {
+	a.cfgMu.RLock()
+	defer a.cfgMu.RUnlock()
+
+	status := map[string]interface{}{
+		"pending_restart": a.configPending,
+	}
+	if !a.configReloaded.IsZero() {
+		status["reloaded_at"] = a.configReloaded
+	}
+	if a.configError != "" {
+		status["error"] = a.configError
+	}
+	if keys := a.overrides.keys(); len(keys) > 0 {
+		status["runtime_overrides"] = keys
+	}
+	return status
+}
+
+// runtimeOverrides - настройки, измененные командами во время работы. В файл
+// конфигурации они не пишутся, поэтому накладываются поверх него при каждой
+// перезагрузке и действуют до перезапуска агента.
+type runtimeOverrides struct {
+	transform map[string]models.TransformConfig // по имени потока
+	audio     models.AudioUpdate                // stream.audio, только заданные поля
+	overlay   models.OverlayUpdate              // stream.overlay, только заданные поля
+}
+
+func (o *runtimeOverrides) setTransform(stream string, t models.TransformConfig) {
+	if o.transform == nil {
+		o.transform = make(map[string]models.TransformConfig)
+	}
+	o.transform[stream] = t
+}
+
+// setAudio запоминает значения, а не указатели из команды.
+func (o *runtimeOverrides) setAudio(u models.AudioUpdate) {
+	if u.Enabled != nil {
+		v := *u.Enabled
+		o.audio.Enabled = &v
+	}
+	if u.Volume != nil {
+		v := *u.Volume
+		o.audio.Volume = &v
+	}
+	if u.Mute != nil {
+		v := *u.Mute
+		o.audio.Mute = &v
+	}
+}
+
+// setOverlay, как и setAudio, запоминает значения, а не указатели из команды.
+func (o *runtimeOverrides) setOverlay(u models.OverlayUpdate) {
+	if u.Enabled != nil {
+		v := *u.Enabled
+		o.overlay.Enabled = &v
+	}
+	if u.Mode != nil {
+		v := *u.Mode
+		o.overlay.Mode = &v
+	}
+	if u.Message != nil {
+		v := *u.Message
+		o.overlay.Message = &v
+	}
+}
+
+// apply накладывает изменения на перечитанную конфигурацию.
+func (o *runtimeOverrides) apply(cfg *models.AppConfig) {
+	for name, t := range o.transform {
+		if s := streamByName(cfg, name); s != nil {
+			s.Transform = t
+		}
+	}
+	if o.audio.Enabled != nil {
+		cfg.Stream.Audio.Enabled = *o.audio.Enabled
+	}
+	if o.audio.Volume != nil {
+		cfg.Stream.Audio.Volume = *o.audio.Volume
+	}
+	if o.audio.Mute != nil {
+		cfg.Stream.Audio.Mute = *o.audio.Mute
+	}
+	if o.overlay.Enabled != nil {
+		cfg.Stream.Overlay.Enabled = *o.overlay.Enabled
+	}
+	if o.overlay.Mode != nil {
+		cfg.Stream.Overlay.Mode = *o.overlay.Mode
+	}
+	if o.overlay.Message != nil {
+		cfg.Stream.Overlay.Message = *o.overlay.Message
+	}
+}
+
+// keys - измененные ключи конфигурации для статуса.
+func (o *runtimeOverrides) keys() []string {
+	var keys []string
+	for name := range o.transform {
+		keys = append(keys, streamKey(name)+".transform")
+	}
+	if o.audio.Enabled != nil {
+		keys = append(keys, "stream.audio.enabled")
+	}
+	if o.audio.Volume != nil {
+		keys = append(keys, "stream.audio.volume")
+	}
+	if o.audio.Mute != nil {
+		keys = append(keys, "stream.audio.mute")
+	}
+	if o.overlay.Enabled != nil {
+		keys = append(keys, "stream.overlay.enabled")
+	}
+	if o.overlay.Mode != nil {
+		keys = append(keys, "stream.overlay.mode")
+	}
+	if o.overlay.Message != nil {
+		keys = append(keys, "stream.overlay.message")
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// streamByName - конфиг потока по имени; nil, если такого потока в cfg нет.
+func streamByName(cfg *models.AppConfig, name string) *models.StreamConfig {
+	if name == config.DefaultStream {
+		return &cfg.Stream
+	}
+	for i := range cfg.Streams {
+		if cfg.Streams[i].Name == name {
+			return &cfg.Streams[i]
+		}
+	}
+	return nil
+}
+
+func streamKey(name string) string {
+	if name == config.DefaultStream {
+		return "stream"
+	}
+	return "streams." + name
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"rentiga-device/config"
+	"rentiga-device/models"
+)
+
+func TestRuntimeOverrides(t *testing.T) {
+	on, off := true, false
+	volume := 0.5
+	mode, message := "message", "back in 5 minutes"
+	rotated := models.TransformConfig{Rotate: 90}
+
+	tests := []struct {
+		name  string
+		set   func(*runtimeOverrides)
+		check func(*models.AppConfig) bool
+		keys  []string
+	}{
+		{"none", func(*runtimeOverrides) {}, func(c *models.AppConfig) bool {
+			return reflect.DeepEqual(c, fileConfig())
+		}, nil},
+		{"transform of main stream", func(o *runtimeOverrides) {
+			o.setTransform(config.DefaultStream, rotated)
+		}, func(c *models.AppConfig) bool {
+			return c.Stream.Transform == rotated && c.Streams[0].Transform == models.TransformConfig{}
+		}, []string{"stream.transform"}},
+		{"transform of extra stream", func(o *runtimeOverrides) {
+			o.setTransform("cam2", rotated)
+		}, func(c *models.AppConfig) bool {
+			return c.Streams[0].Transform == rotated && c.Stream.Transform == models.TransformConfig{}
+		}, []string{"streams.cam2.transform"}},
+		{"transform of removed stream", func(o *runtimeOverrides) {
+			o.setTransform("gone", rotated)
+		}, func(c *models.AppConfig) bool {
+			return reflect.DeepEqual(c, fileConfig())
+		}, []string{"streams.gone.transform"}},
+		{"audio, only set fields", func(o *runtimeOverrides) {
+			o.setAudio(models.AudioUpdate{Volume: &volume})
+			o.setAudio(models.AudioUpdate{Mute: &on})
+		}, func(c *models.AppConfig) bool {
+			return c.Stream.Audio.Volume == volume && c.Stream.Audio.Mute && c.Stream.Audio.Enabled
+		}, []string{"stream.audio.mute", "stream.audio.volume"}},
+		{"overlay, only set fields", func(o *runtimeOverrides) {
+			o.setOverlay(models.OverlayUpdate{Mode: &mode, Message: &message})
+			o.setOverlay(models.OverlayUpdate{Enabled: &off})
+		}, func(c *models.AppConfig) bool {
+			ov := c.Stream.Overlay
+			return !ov.Enabled && ov.Mode == mode && ov.Message == message && ov.Position == "bottom"
+		}, []string{"stream.overlay.enabled", "stream.overlay.message", "stream.overlay.mode"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var o runtimeOverrides
+			tt.set(&o)
+
+			cfg := fileConfig()
+			o.apply(cfg)
+			if !tt.check(cfg) {
+				t.Errorf("apply() gave stream %+v, streams %+v", cfg.Stream, cfg.Streams)
+			}
+			if got := o.keys(); !reflect.DeepEqual(got, tt.keys) {
+				t.Errorf("keys() = %v, want %v", got, tt.keys)
+			}
+		})
+	}
+}
+
+// fileConfig - конфигурация, как она перечитана из файла.
+func fileConfig() *models.AppConfig {
+	cfg := config.Default()
+	cfg.Stream.Audio = models.AudioConfig{Enabled: true, Volume: 1}
+	cfg.Stream.Overlay.Enabled = true
+	cfg.Streams = []models.StreamConfig{{Name: "cam2", Device: "/dev/video2"}}
+	return cfg
+}
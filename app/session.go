@@ -0,0 +1,269 @@
+// app/session.go
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"rentiga-device/certificate"
+	"rentiga-device/models"
+)
+
+const (
+	EventSessionStarted  = "session_started"
+	EventSessionExtended = "session_extended"
+	EventSessionEnded    = "session_ended"
+	EventSessionExpired  = "session_expired"
+)
+
+const sessionFile = "session.json"
+
+func sessionPath() string {
+	return filepath.Join(certificate.GetStateDir(), sessionFile)
+}
+
+// sessionInfo возвращает копию текущего сеанса с пересчитанным остатком времени или nil.
+// Вызывается под sessionMu.
+func (a *App) sessionInfo() *models.SessionInfo {
+	if a.session == nil {
+		return nil
+	}
+
+	info := *a.session
+	info.RemainingSec = int(time.Until(info.ExpiresAt).Round(time.Second).Seconds())
+	if info.RemainingSec < 0 {
+		info.RemainingSec = 0
+	}
+	return &info
+}
+
+// Session возвращает текущий сеанс аренды или nil.
+func (a *App) Session() *models.SessionInfo {
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+
+	return a.sessionInfo()
+}
+
+func sessionExpiry(cmd models.CommandMessage, from time.Time) (time.Time, error) {
+	switch {
+	case cmd.ExpiresAt != nil:
+		return *cmd.ExpiresAt, nil
+	case cmd.DurationSec > 0:
+		return from.Add(time.Duration(cmd.DurationSec) * time.Second), nil
+	default:
+		return time.Time{}, errors.New("duration_sec or expires_at is required")
+	}
+}
+
+func (a *App) startSession(cmd models.CommandMessage) error {
+	if cmd.SessionID == "" {
+		return permanent(errors.New("session_id is required"))
+	}
+
+	now := time.Now()
+	expiresAt, err := sessionExpiry(cmd, now)
+	if err != nil {
+		return permanent(err)
+	}
+	if !expiresAt.After(now) {
+		return permanent(fmt.Errorf("session %s already expired at %s", cmd.SessionID, expiresAt.Format(time.RFC3339)))
+	}
+
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+
+	if a.session != nil && a.session.ID != cmd.SessionID {
+		return permanent(fmt.Errorf("session %s is already active", a.session.ID))
+	}
+	// повтор той же команды (например, после requeue) не создает второй сеанс
+	repeated := a.session != nil
+
+	a.sessionEnd.Store(expiresAt.UnixNano())
+	if err := a.startStream(); err != nil {
+		if repeated {
+			a.sessionEnd.Store(a.session.ExpiresAt.UnixNano())
+		} else {
+			a.sessionEnd.Store(0)
+		}
+		return err
+	}
+
+	if !repeated {
+		a.session = &models.SessionInfo{
+			ID:        cmd.SessionID,
+			Customer:  cmd.Customer,
+			StartedAt: now.UTC(),
+		}
+	}
+	a.session.ExpiresAt = expiresAt.UTC()
+	a.scheduleSessionEnd()
+	a.saveSession()
+
+	log.Printf("Session %s started, expires at %s", a.session.ID, a.session.ExpiresAt.Format(time.RFC3339))
+	if !repeated {
+		go a.emitEvent(EventSessionStarted, a.sessionEventData())
+	}
+	return nil
+}
+
+func (a *App) extendSession(cmd models.CommandMessage) error {
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+
+	if a.session == nil {
+		return permanent(errors.New("no active session"))
+	}
+	if cmd.SessionID != "" && cmd.SessionID != a.session.ID {
+		return permanent(fmt.Errorf("session %s is not active (active: %s)", cmd.SessionID, a.session.ID))
+	}
+
+	expiresAt, err := sessionExpiry(cmd, a.session.ExpiresAt)
+	if err != nil {
+		return permanent(err)
+	}
+	if !expiresAt.After(time.Now()) {
+		return permanent(fmt.Errorf("new expiry %s is in the past", expiresAt.Format(time.RFC3339)))
+	}
+
+	a.session.ExpiresAt = expiresAt.UTC()
+	a.scheduleSessionEnd()
+	a.saveSession()
+
+	log.Printf("Session %s extended until %s", a.session.ID, a.session.ExpiresAt.Format(time.RFC3339))
+	go a.emitEvent(EventSessionExtended, a.sessionEventData())
+	return nil
+}
+
+// endSession завершает сеанс (если он есть) и останавливает трансляцию.
+func (a *App) endSession(eventType string) {
+	a.sessionMu.Lock()
+	if a.session == nil {
+		a.sessionMu.Unlock()
+		return
+	}
+
+	data := a.sessionEventData()
+	log.Printf("Session %s finished (%s)", a.session.ID, eventType)
+	a.clearSession()
+	a.sessionMu.Unlock()
+
+	a.StopStream()
+	a.emitEvent(eventType, data)
+}
+
+// clearSession вызывается под sessionMu.
+func (a *App) clearSession() {
+	if a.sessionTimer != nil {
+		a.sessionTimer.Stop()
+		a.sessionTimer = nil
+	}
+	a.session = nil
+	a.sessionEnd.Store(0)
+
+	if err := os.Remove(sessionPath()); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove session file: %v", err)
+	}
+}
+
+// sessionRemaining отдает плашке остаток времени сеанса. Плашка рисуется под своим
+// мьютексом и из-под sessionMu, поэтому время окончания читается атомарно.
+func (a *App) sessionRemaining() (time.Duration, bool) {
+	end := a.sessionEnd.Load()
+	if end == 0 {
+		return 0, false
+	}
+	return time.Until(time.Unix(0, end)), true
+}
+
+// scheduleSessionEnd (пере)заводит таймер окончания сеанса. Вызывается под sessionMu.
+// Таймер живет в процессе и не зависит от соединения с брокером.
+func (a *App) scheduleSessionEnd() {
+	if a.sessionTimer != nil {
+		a.sessionTimer.Stop()
+	}
+	a.sessionEnd.Store(a.session.ExpiresAt.UnixNano())
+
+	id := a.session.ID
+	a.sessionTimer = time.AfterFunc(time.Until(a.session.ExpiresAt), func() {
+		a.sessionMu.Lock()
+		current := a.session != nil && a.session.ID == id && !time.Now().Before(a.session.ExpiresAt)
+		a.sessionMu.Unlock()
+
+		if current {
+			a.endSession(EventSessionExpired)
+		}
+	})
+}
+
+// sessionEventData вызывается под sessionMu.
+func (a *App) sessionEventData() map[string]interface{} {
+	info := a.sessionInfo()
+	if info == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"session_id":    info.ID,
+		"customer":      info.Customer,
+		"started_at":    info.StartedAt,
+		"expires_at":    info.ExpiresAt,
+		"remaining_sec": info.RemainingSec,
+	}
+}
+
+// saveSession вызывается под sessionMu.
+func (a *App) saveSession() {
+	data, err := json.Marshal(a.session)
+	if err != nil {
+		log.Printf("Failed to encode session: %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(sessionPath()), 0700); err != nil {
+		log.Printf("Failed to save session: %v", err)
+		return
+	}
+	if err := os.WriteFile(sessionPath(), data, 0600); err != nil {
+		log.Printf("Failed to save session: %v", err)
+	}
+}
+
+// restoreSession продолжает сеанс, прерванный перезапуском агента.
+// Истекший за время простоя сеанс просто удаляется.
+func (a *App) restoreSession() {
+	data, err := os.ReadFile(sessionPath())
+	if err != nil {
+		return
+	}
+
+	var saved models.SessionInfo
+	if err := json.Unmarshal(data, &saved); err != nil || saved.ID == "" {
+		log.Printf("Ignoring corrupted session file: %v", err)
+		os.Remove(sessionPath())
+		return
+	}
+
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+
+	a.session = &saved
+	if !time.Now().Before(saved.ExpiresAt) {
+		log.Printf("Saved session %s expired while the agent was down", saved.ID)
+		data := a.sessionEventData()
+		a.clearSession()
+		go a.emitEvent(EventSessionExpired, data)
+		return
+	}
+
+	log.Printf("Resuming session %s until %s", saved.ID, saved.ExpiresAt.Format(time.RFC3339))
+	a.sessionEnd.Store(saved.ExpiresAt.UnixNano())
+	if err := a.startStream(); err != nil {
+		log.Printf("Failed to resume stream for session %s: %v", saved.ID, err)
+	}
+	a.scheduleSessionEnd()
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"rentiga-device/models"
+)
+
+const EventSnapshotTaken = "snapshot_taken"
+
+const snapshotPrefix = "snapshot-"
+
+// TakeSnapshot снимает текущий кадр потока stream (пусто - основной) в
+// stream.snapshot.dir и, если upload, отправляет его на бэкенд через клиент
+// с сертификатом устройства. Снимки всех потоков лежат в одном каталоге,
+// имя дополнительного потока добавляется после времени.
+func (a *App) TakeSnapshot(stream string, upload bool) (models.SnapshotInfo, error) {
+	u, err := a.stream(stream)
+	if err != nil {
+		return models.SnapshotInfo{}, err
+	}
+
+	a.cfgMu.RLock()
+	cfg := a.config.Stream.Snapshot
+	a.cfgMu.RUnlock()
+
+	now := time.Now().UTC()
+	name := snapshotPrefix + now.Format("20060102T150405.000Z")
+	if u != a.main {
+		name += "-" + u.name
+	}
+	path := filepath.Join(cfg.Dir, name+".jpg")
+
+	source, err := u.streamer.Snapshot(path, cfg.Quality)
+	if err != nil {
+		return models.SnapshotInfo{}, err
+	}
+
+	info := models.SnapshotInfo{File: filepath.Base(path), TakenAt: now, Source: source}
+	if u != a.main {
+		info.Stream = u.name
+	}
+	if st, err := os.Stat(path); err == nil {
+		info.Size = st.Size()
+	}
+	pruneSnapshots(cfg.Dir, cfg.MaxFiles)
+
+	if upload {
+		if err := a.uploadSnapshot(path); err != nil {
+			a.setLastSnapshot(info)
+			return info, fmt.Errorf("snapshot saved but upload failed: %v", err)
+		}
+		info.Uploaded = true
+	}
+	a.setLastSnapshot(info)
+
+	data := map[string]interface{}{
+		"file":     info.File,
+		"source":   info.Source,
+		"size":     info.Size,
+		"uploaded": info.Uploaded,
+	}
+	if info.Stream != "" {
+		data["stream"] = info.Stream
+	}
+	a.emitEvent(EventSnapshotTaken, data)
+	return info, nil
+}
+
+// SnapshotPath возвращает путь сохраненного снимка по имени файла.
+func (a *App) SnapshotPath(file string) (string, error) {
+	if file != filepath.Base(file) || !strings.HasPrefix(file, snapshotPrefix) {
+		return "", fmt.Errorf("invalid snapshot name %q", file)
+	}
+	a.cfgMu.RLock()
+	dir := a.config.Stream.Snapshot.Dir
+	a.cfgMu.RUnlock()
+
+	path := filepath.Join(dir, file)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("snapshot %s not found", file)
+	}
+	return path, nil
+}
+
+func (a *App) LastSnapshot() *models.SnapshotInfo {
+	a.snapshotMu.Lock()
+	defer a.snapshotMu.Unlock()
+
+	if a.lastSnapshot == nil {
+		return nil
+	}
+	info := *a.lastSnapshot
+	return &info
+}
+
+func (a *App) setLastSnapshot(info models.SnapshotInfo) {
+	a.snapshotMu.Lock()
+	a.lastSnapshot = &info
+	a.snapshotMu.Unlock()
+}
+
+func (a *App) uploadSnapshot(path string) error {
+	deviceID := a.certManager.Config().DeviceID
+	if !a.certManager.IsLoaded() || deviceID == "" {
+		return fmt.Errorf("certificate is not loaded")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	url := a.backendURL("/tls/devices/%s/snapshots", deviceID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.Header.Set("X-Snapshot-File", filepath.Base(path))
+
+	resp, err := a.certManager.HTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("backend returned %s", resp.Status)
+	}
+	return nil
+}
+
+// pruneSnapshots оставляет maxFiles последних снимков. Имена содержат время,
+// поэтому сортировка по имени - это сортировка по времени.
+func pruneSnapshots(dir string, maxFiles int) {
+	if maxFiles <= 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*.jpg"))
+	if err != nil || len(files) <= maxFiles {
+		return
+	}
+	sort.Strings(files)
+	for _, f := range files[:len(files)-maxFiles] {
+		if err := os.Remove(f); err != nil {
+			log.Printf("Failed to remove old snapshot: %v", err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"rentiga-device/certificate"
+	"rentiga-device/config"
+	"rentiga-device/models"
+	"rentiga-device/streaming"
+)
+
+// streamUnit - один поток: устройство захвата, пайплайн и заставка на своем коннекторе.
+// Основной поток (stream) связан с сеансом аренды, записью, превью, сетевым выводом
+// и звуком; дополнительные (streams) только выводят картинку и управляются по имени.
+type streamUnit struct {
+	name        string
+	streamer    *streaming.Streamer
+	idle        *streaming.IdleScreen
+	isStreaming bool // под a.mu
+}
+
+func newStreamUnit(name string, cfg models.StreamConfig, deviceID string) *streamUnit {
+	u := &streamUnit{
+		name:     name,
+		streamer: streaming.NewStreamer(cfg, deviceID),
+		idle:     streaming.NewIdleScreen(cfg),
+	}
+	decoderState := "decoder"
+	if name != config.DefaultStream {
+		decoderState += "-" + name
+	}
+	u.streamer.DecoderStatePath = filepath.Join(certificate.GetStateDir(), decoderState)
+	return u
+}
+
+// eventData - данные событий потока; у основного потока их нет, как и раньше.
+func (u *streamUnit) eventData() map[string]interface{} {
+	if u.name == config.DefaultStream {
+		return nil
+	}
+	return map[string]interface{}{"stream": u.name}
+}
+
+// units - основной поток и дополнительные в порядке конфига.
+func (a *App) units() []*streamUnit {
+	return append([]*streamUnit{a.main}, a.extra...)
+}
+
+// stream находит поток по имени; пустое имя - основной поток.
+func (a *App) stream(name string) (*streamUnit, error) {
+	if name == "" || name == config.DefaultStream {
+		return a.main, nil
+	}
+	for _, u := range a.extra {
+		if u.name == name {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown stream %q", name)
+}
+
+// HasStream сообщает, есть ли поток с таким именем; пустое имя - основной поток.
+func (a *App) HasStream(name string) bool {
+	_, err := a.stream(name)
+	return err == nil
+}
+
+// StartStreamByName запускает поток по имени; пустое имя - основной поток.
+func (a *App) StartStreamByName(name string) error {
+	u, err := a.stream(name)
+	if err != nil {
+		return err
+	}
+	if u == a.main {
+		return a.startStream()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.startUnit(u)
+}
+
+// StopStreamByName останавливает поток по имени. Сеанс аренды при этом не
+// завершается: он привязан к основному потоку.
+func (a *App) StopStreamByName(name string) error {
+	u, err := a.stream(name)
+	if err != nil {
+		return err
+	}
+	if u == a.main {
+		a.StopStream()
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stopUnit(u)
+	return nil
+}
+
+// startUnit вызывается под a.mu.
+func (a *App) startUnit(u *streamUnit) error {
+	if u.isStreaming {
+		return nil
+	}
+
+	// заставка и поток используют один коннектор
+	u.idle.Hide()
+	if err := u.streamer.Start(); err != nil {
+		a.showIdle(u)
+		return err
+	}
+
+	u.isStreaming = true
+	go a.emitEvent(EventStreamStarted, u.eventData())
+	return nil
+}
+
+// stopUnit вызывается под a.mu.
+func (a *App) stopUnit(u *streamUnit) {
+	if !u.isStreaming {
+		return
+	}
+
+	u.streamer.Stop()
+	u.isStreaming = false
+	a.showIdle(u)
+	go a.emitEvent(EventStreamStopped, u.eventData())
+}
+
+// applyUnitConfig применяет новый конфиг дополнительного потока. Без restart
+// меняются только поля, которые пайплайн не читает (плашка обновляется на лету);
+// иначе идущий поток перезапускается: streamer читает конфиг при запуске.
+func (a *App) applyUnitConfig(u *streamUnit, cfg models.StreamConfig, restart bool) error {
+	if !restart {
+		if err := u.streamer.Overlay().Update(cfg.Overlay); err != nil {
+			log.Printf("Overlay config rejected (%s): %v", u.name, err)
+		}
+		a.cfgMu.Lock()
+		st := a.streamConfig(u)
+		st.Overlay, st.Recording, st.Preview = cfg.Overlay, cfg.Recording, cfg.Preview
+		st.Network, st.Audio = cfg.Network, cfg.Audio
+		a.cfgMu.Unlock()
+		a.updateUnit(u)
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	running := u.isStreaming
+	if running {
+		u.streamer.Stop()
+	}
+	// заставку перерисовываем с новыми настройками
+	u.idle.Hide()
+	a.cfgMu.Lock()
+	*a.streamConfig(u) = cfg
+	a.cfgMu.Unlock()
+	a.updateUnit(u)
+	if err := u.streamer.Overlay().Update(cfg.Overlay); err != nil {
+		log.Printf("Overlay config rejected (%s): %v", u.name, err)
+	}
+
+	if !running {
+		a.showIdle(u)
+		return nil
+	}
+	if err := u.streamer.Start(); err != nil {
+		log.Printf("Stream %s restart after config change failed: %v", u.name, err)
+		u.isStreaming = false
+		a.showIdle(u)
+		return err
+	}
+	log.Printf("Stream %s restarted with new config", u.name)
+	return nil
+}
+
+// updateUnit передает потоку и его заставке копию конфига из a.config: они
+// читают его под своими локами, а не под cfgMu.
+func (a *App) updateUnit(u *streamUnit) {
+	a.cfgMu.RLock()
+	cfg := *a.streamConfig(u)
+	a.cfgMu.RUnlock()
+
+	u.streamer.Update(cfg)
+	u.idle.Update(cfg)
+}
+
+func (a *App) showIdle(u *streamUnit) {
+	if err := u.idle.Show(); err != nil {
+		log.Printf("Idle screen error (%s): %v", u.name, err)
+	}
+}
+
+// onSourceEvent показывает заставку, пока поток ждет устройство захвата, и убирает
+// ее перед возобновлением: пайплайн займет тот же коннектор.
+func (a *App) onSourceEvent(u *streamUnit, event string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !u.isStreaming {
+		return
+	}
+	switch event {
+	case streaming.EventSourceLost:
+		a.showIdle(u)
+	case streaming.EventSourceRestored:
+		u.idle.Hide()
+	}
+}
+
+// onUnitEvent - события супервизора дополнительного потока, с его именем в данных.
+func (a *App) onUnitEvent(u *streamUnit) func(string, map[string]interface{}) {
+	return func(event string, data map[string]interface{}) {
+		if event == streaming.EventFailed {
+			a.mu.Lock()
+			u.isStreaming = false
+			a.showIdle(u)
+			a.mu.Unlock()
+		}
+		a.onSourceEvent(u, event)
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+		data["stream"] = u.name
+		a.emitEvent(event, data)
+	}
+}
+
+// StreamsStatus перечисляет все потоки с их устройствами и состоянием.
+func (a *App) StreamsStatus() []map[string]interface{} {
+	a.mu.Lock()
+	running := make(map[string]bool)
+	for _, u := range a.units() {
+		running[u.name] = u.isStreaming
+	}
+	a.mu.Unlock()
+
+	var list []map[string]interface{}
+	for _, u := range a.units() {
+		a.cfgMu.RLock()
+		cfg := *a.streamConfig(u)
+		a.cfgMu.RUnlock()
+
+		list = append(list, map[string]interface{}{
+			"name":        u.name,
+			"device":      cfg.Device,
+			"connector":   cfg.Connector,
+			"template":    cfg.Template,
+			"streaming":   running[u.name],
+			"idle_screen": u.idle.Visible(),
+			"pipeline":    u.streamer.Status(),
+		})
+	}
+	return list
+}
+
+// extraStatus - состояние дополнительных потоков для GetStatus; nil, если их нет.
+func (a *App) extraStatus() map[string]interface{} {
+	if len(a.extra) == 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	running := make(map[string]bool)
+	for _, u := range a.extra {
+		running[u.name] = u.isStreaming
+	}
+	a.mu.Unlock()
+
+	status := make(map[string]interface{})
+	for _, u := range a.extra {
+		status[u.name] = map[string]interface{}{
+			"streaming":   running[u.name],
+			"idle_screen": u.idle.Visible(),
+			"pipeline":    u.streamer.Status(),
+		}
+	}
+	return status
+}
+
+// StreamNames - имена всех потоков, основной первым.
+func (a *App) StreamNames() []string {
+	var names []string
+	for _, u := range a.units() {
+		names = append(names, u.name)
+	}
+	return names
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"rentiga-device/models"
+	"rentiga-device/streaming"
+)
+
+// TransformConfig возвращает текущие поворот, отражения, обрезку и масштаб потока.
+func (a *App) TransformConfig(stream string) (models.TransformConfig, error) {
+	u, err := a.stream(stream)
+	if err != nil {
+		return models.TransformConfig{}, err
+	}
+
+	a.cfgMu.RLock()
+	defer a.cfgMu.RUnlock()
+
+	return a.streamConfig(u).Transform, nil
+}
+
+// SetTransform меняет преобразование кадра потока. Оно меняет состав пайплайна,
+// поэтому идущий поток перезапускается. Изменение переживает перезагрузку
+// конфигурации, но не перезапуск агента.
+func (a *App) SetTransform(stream string, t models.TransformConfig) error {
+	u, err := a.stream(stream)
+	if err != nil {
+		return err
+	}
+	if err := streaming.ValidateTransform(t); err != nil {
+		return err
+	}
+
+	a.cfgMu.RLock()
+	cfg := *a.streamConfig(u)
+	a.cfgMu.RUnlock()
+
+	if cfg.Transform == t {
+		return nil
+	}
+	cfg.Transform = t
+	if err := streaming.ValidateTemplate(&cfg); err != nil {
+		return err
+	}
+	a.cfgMu.Lock()
+	a.overrides.setTransform(u.name, t)
+	a.cfgMu.Unlock()
+	if u == a.main {
+		a.applyStreamConfig(cfg)
+		return nil
+	}
+	return a.applyUnitConfig(u, cfg, true)
+}
+
+// streamConfig - конфиг потока в a.config. Вызывается под cfgMu.
+func (a *App) streamConfig(u *streamUnit) *models.StreamConfig {
+	for i := range a.config.Streams {
+		if a.config.Streams[i].Name == u.name {
+			return &a.config.Streams[i]
+		}
+	}
+	return &a.config.Stream
+}
@@ -31,8 +31,13 @@ func NewManager(cfg *models.CertificateConfig) *Manager {
 }
 
 func GetConfigPath() string {
+    return filepath.Join(GetStateDir(), certsDir)
+}
+
+// GetStateDir - каталог агента, где хранится все, что должно пережить перезапуск.
+func GetStateDir() string {
     home, _ := os.UserHomeDir()
-    return filepath.Join(home, configDir, certsDir)
+    return filepath.Join(home, configDir)
 }
 
 func (m *Manager) SaveCertificate() error {
@@ -0,0 +1,474 @@
+// config/config.go
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"rentiga-device/models"
+	"rentiga-device/streaming"
+
+	"github.com/streadway/amqp"
+)
+
+// DefaultStream - имя основного потока (секция stream) в командах и API.
+const DefaultStream = "main"
+
+var streamName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// EnvPrefix - префикс переменных окружения, переопределяющих значения из файла.
+const EnvPrefix = "RENTIGA_"
+
+// Default возвращает конфигурацию со значениями, общими для всех устройств.
+// Параметры, уникальные для устройства, и секреты должны прийти из файла или окружения.
+func Default() *models.AppConfig {
+	return &models.AppConfig{
+		Certificate: models.CertificateConfig{
+			TempDir:  "/tmp/certs",
+			CertPath: "/tmp/certs/client.crt",
+			KeyPath:  "/tmp/certs/client.key",
+			CaPath:   "/tmp/certs/ca.crt",
+		},
+		Stream: models.StreamConfig{
+			Device:     "/dev/video0",
+			Resolution: "1920x1080",
+			Backend:    streaming.BackendGStreamer,
+			Template:   streaming.DefaultTemplate,
+			Decoder:    streaming.DecoderAuto,
+			FrameTap:   true,
+			TempDir:    "/tmp/rentiga",
+			QRPath:     "/tmp/qr.png",
+			Overlay: models.OverlayConfig{
+				Mode:            streaming.OverlayClock,
+				ClockFormat:     "15:04:05",
+				Position:        "bottom",
+				FontSize:        100,
+				Color:           "#FFFFFFE6",
+				BackgroundColor: "#00000080",
+			},
+			Snapshot: models.SnapshotConfig{
+				Dir:      "/tmp/rentiga/snapshots",
+				MaxFiles: 20,
+				Quality:  85,
+			},
+			Recording: models.RecordingConfig{
+				Dir:         "/tmp/rentiga/recordings",
+				Format:      "mp4",
+				Encoder:     "auto",
+				SegmentSec:  300,
+				BitrateKbps: 4000,
+				MaxSizeMB:   10240,
+				MaxAgeHours: 72,
+			},
+			Preview: models.PreviewConfig{
+				Width:      640,
+				Framerate:  "5/1",
+				Quality:    70,
+				MaxViewers: 3,
+			},
+			Network: models.NetworkConfig{
+				Protocol:       streaming.NetworkHLS,
+				Dir:            "/tmp/rentiga/hls",
+				Width:          1280,
+				Encoder:        "auto",
+				BitrateKbps:    2500,
+				SegmentSec:     2,
+				PlaylistLength: 5,
+			},
+			Audio: models.AudioConfig{
+				Input:  streaming.AudioAuto,
+				Volume: 1.0,
+			},
+			Idle: models.IdleConfig{
+				StatusText:      "Scan to rent",
+				BackgroundColor: "#000000",
+				TextColor:       "#FFFFFF",
+			},
+			Restart: models.RestartConfig{
+				MaxRestarts:   5,
+				BackoffSec:    1,
+				MaxBackoffSec: 30,
+				StableSec:     60,
+			},
+		},
+		Web: models.WebConfig{
+			Port: ":8888",
+		},
+		Broker: models.BrokerConfig{
+			CommandExchange:    "device.commands",
+			DeadLetterExchange: "device.commands.dlx",
+			EventExchange:      "device.events",
+			StatusInterval:     30,
+		},
+	}
+}
+
+// Load собирает конфигурацию: значения по умолчанию, затем JSON-файл (если path не пустой),
+// затем переменные окружения RENTIGA_*. Результат проходит Validate.
+// Переменные STREAM_* меняют только основной поток, дополнительные наследуют файл.
+func Load(path string) (*models.AppConfig, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *models.AppConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	// элементы streams наследуют секцию stream: поверх ее копии накладываются
+	// только поля, заданные в элементе
+	var extra struct {
+		Streams []json.RawMessage `json:"streams"`
+	}
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	cfg.Streams = nil
+	for i, raw := range extra.Streams {
+		st := cfg.Stream
+		st.Templates = maps.Clone(cfg.Stream.Templates)
+		st.Variables = maps.Clone(cfg.Stream.Variables)
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return fmt.Errorf("failed to parse streams[%d] in %s: %w", i, path, err)
+		}
+		// рабочие файлы (плашка, сокет отвода, QR) у каждого потока свои
+		if st.TempDir == cfg.Stream.TempDir {
+			st.TempDir = filepath.Join(cfg.Stream.TempDir, st.Name)
+		}
+		if st.QRPath == cfg.Stream.QRPath {
+			st.QRPath = filepath.Join(st.TempDir, "qr.png")
+		}
+		cfg.Streams = append(cfg.Streams, st)
+	}
+	return nil
+}
+
+type envVar struct {
+	name   string
+	target interface{}
+}
+
+func envVars(cfg *models.AppConfig) []envVar {
+	return []envVar{
+		{"CERT_PATH", &cfg.Certificate.CertPath},
+		{"KEY_PATH", &cfg.Certificate.KeyPath},
+		{"CA_PATH", &cfg.Certificate.CaPath},
+		{"CERT_TEMP_DIR", &cfg.Certificate.TempDir},
+
+		{"STREAM_DEVICE", &cfg.Stream.Device},
+		{"STREAM_RESOLUTION", &cfg.Stream.Resolution},
+		{"STREAM_FONT_PATH", &cfg.Stream.FontPath},
+		{"STREAM_TEMP_DIR", &cfg.Stream.TempDir},
+		{"STREAM_QR_PATH", &cfg.Stream.QRPath},
+		{"STREAM_CONNECTOR_ID", &cfg.Stream.ConnectorID},
+		{"STREAM_CONNECTOR", &cfg.Stream.Connector},
+		{"STREAM_BACKEND", &cfg.Stream.Backend},
+		{"STREAM_FFMPEG_OUTPUT", &cfg.Stream.FFmpegOutput},
+		{"STREAM_TEST_OUTPUT", &cfg.Stream.TestOutput},
+		{"STREAM_TEMPLATE", &cfg.Stream.Template},
+		{"STREAM_FRAMERATE", &cfg.Stream.Framerate},
+		{"STREAM_CAPS", &cfg.Stream.Caps},
+		{"STREAM_DECODER", &cfg.Stream.Decoder},
+		{"STREAM_FRAME_TAP", &cfg.Stream.FrameTap},
+		{"STREAM_SNAPSHOT_DIR", &cfg.Stream.Snapshot.Dir},
+		{"STREAM_RECORDING_AUTO_START", &cfg.Stream.Recording.AutoStart},
+		{"STREAM_RECORDING_DIR", &cfg.Stream.Recording.Dir},
+		{"STREAM_NETWORK_ENABLED", &cfg.Stream.Network.Enabled},
+		{"STREAM_NETWORK_PROTOCOL", &cfg.Stream.Network.Protocol},
+		{"STREAM_NETWORK_RTSP_URL", &cfg.Stream.Network.RTSPURL},
+		{"STREAM_AUDIO_ENABLED", &cfg.Stream.Audio.Enabled},
+		{"STREAM_AUDIO_INPUT", &cfg.Stream.Audio.Input},
+		{"STREAM_AUDIO_OUTPUT", &cfg.Stream.Audio.Output},
+		{"STREAM_OVERLAY_ENABLED", &cfg.Stream.Overlay.Enabled},
+		{"STREAM_OVERLAY_MODE", &cfg.Stream.Overlay.Mode},
+		{"STREAM_OVERLAY_MESSAGE", &cfg.Stream.Overlay.Message},
+		{"STREAM_MAX_RESTARTS", &cfg.Stream.Restart.MaxRestarts},
+		{"STREAM_IDLE_ENABLED", &cfg.Stream.Idle.Enabled},
+		{"STREAM_IDLE_URL_TEMPLATE", &cfg.Stream.Idle.URLTemplate},
+		{"STREAM_IDLE_LOGO_PATH", &cfg.Stream.Idle.LogoPath},
+		{"STREAM_IDLE_STATUS_TEXT", &cfg.Stream.Idle.StatusText},
+
+		{"WEB_PORT", &cfg.Web.Port},
+		{"WEB_USERNAME", &cfg.Web.Auth.Username},
+		{"WEB_PASSWORD", &cfg.Web.Auth.Password},
+
+		{"BROKER_URI", &cfg.Broker.URI},
+		{"BROKER_COMMAND_EXCHANGE", &cfg.Broker.CommandExchange},
+		{"BROKER_DEAD_LETTER_EXCHANGE", &cfg.Broker.DeadLetterExchange},
+		{"BROKER_EVENT_EXCHANGE", &cfg.Broker.EventExchange},
+		{"BROKER_STATUS_INTERVAL_SEC", &cfg.Broker.StatusInterval},
+		{"BACKEND_URL", &cfg.Backend.BaseURL},
+	}
+}
+
+func applyEnv(cfg *models.AppConfig) error {
+	for _, v := range envVars(cfg) {
+		name := EnvPrefix + v.name
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(v.target, value); err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(target interface{}, value string) error {
+	switch t := target.(type) {
+	case *string:
+		*t = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*t = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*t = b
+	case *float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*t = f
+	default:
+		return fmt.Errorf("unsupported type %T", target)
+	}
+	return nil
+}
+
+// Validate проверяет обязательные поля и формат значений и возвращает все найденные ошибки сразу.
+func Validate(cfg *models.AppConfig) error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("config: "+format, args...))
+	}
+
+	required := []struct {
+		key   string
+		value string
+	}{
+		{"certificate.cert_path", cfg.Certificate.CertPath},
+		{"certificate.key_path", cfg.Certificate.KeyPath},
+		{"certificate.ca_path", cfg.Certificate.CaPath},
+		{"certificate.temp_dir", cfg.Certificate.TempDir},
+		{"stream.device", cfg.Stream.Device},
+		{"stream.temp_dir", cfg.Stream.TempDir},
+		{"web.auth.username", cfg.Web.Auth.Username},
+		{"web.auth.password", cfg.Web.Auth.Password},
+		{"broker.uri", cfg.Broker.URI},
+		{"broker.command_exchange", cfg.Broker.CommandExchange},
+		{"broker.event_exchange", cfg.Broker.EventExchange},
+		{"backend.base_url", cfg.Backend.BaseURL},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			fail("%s is required", r.key)
+		}
+	}
+
+	validateStream("stream", &cfg.Stream, fail)
+
+	names := map[string]bool{}
+	devices := map[string]string{cfg.Stream.Device: "stream"}
+	connectors := map[string]string{}
+	if c := connectorKey(&cfg.Stream); c != "" {
+		connectors[c] = "stream"
+	}
+	for i := range cfg.Streams {
+		st := &cfg.Streams[i]
+		key := fmt.Sprintf("streams[%d]", i)
+		switch {
+		case !streamName.MatchString(st.Name):
+			fail("%s.name must match %s, got %q", key, streamName, st.Name)
+		case st.Name == DefaultStream || names[st.Name]:
+			fail("%s.name %q is already used", key, st.Name)
+		default:
+			key = "streams." + st.Name
+		}
+		names[st.Name] = true
+
+		// два пайплайна не могут открыть одно устройство или вывести на один коннектор
+		if other, ok := devices[st.Device]; ok {
+			fail("%s.device %s is already used by %s", key, st.Device, other)
+		}
+		devices[st.Device] = key
+		if c := connectorKey(st); c != "" {
+			if other, ok := connectors[c]; ok {
+				fail("%s.connector is already used by %s", key, other)
+			}
+			connectors[c] = key
+		}
+		if strings.TrimSpace(st.Device) == "" {
+			fail("%s.device is required", key)
+		}
+		validateStream(key, st, fail)
+	}
+
+	if cfg.Broker.StatusInterval < 0 {
+		fail("broker.status_interval_sec must not be negative")
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Web.Port); err != nil {
+		fail("web.port must look like \":8888\" or \"host:8888\": %v", err)
+	}
+
+	if cfg.Broker.URI != "" {
+		if _, err := amqp.ParseURI(cfg.Broker.URI); err != nil {
+			fail("broker.uri: %v", err)
+		}
+	}
+
+	if cfg.Backend.BaseURL != "" {
+		u, err := url.Parse(cfg.Backend.BaseURL)
+		switch {
+		case err != nil:
+			fail("backend.base_url: %v", err)
+		case u.Scheme != "http" && u.Scheme != "https":
+			fail("backend.base_url must be an http(s) URL, got %q", cfg.Backend.BaseURL)
+		case u.Host == "":
+			fail("backend.base_url has no host: %q", cfg.Backend.BaseURL)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateStream проверяет секцию stream или элемент streams; key - ее путь в сообщениях.
+func validateStream(key string, s *models.StreamConfig, fail func(string, ...interface{})) {
+	if _, err := streaming.PipelineFor(s.Backend); err != nil {
+		fail("%s.backend: %v", key, err)
+	}
+	// коннектор и шаблон нужны только gstreamer; ffmpeg и test выводят изображение иначе
+	if s.Backend == "" || s.Backend == streaming.BackendGStreamer {
+		if strings.TrimSpace(s.ConnectorID) == "" && strings.TrimSpace(s.Connector) == "" {
+			fail("%s.connector or %s.connector_id is required", key, key)
+		}
+		if err := streaming.ValidateTemplate(s); err != nil {
+			fail("%s.template: %v", key, err)
+		}
+	}
+	if err := streaming.ValidateDecoder(s.Decoder); err != nil {
+		fail("%s.decoder: %v", key, err)
+	}
+	if s.Framerate != "" {
+		if _, _, err := streaming.ParseFramerate(s.Framerate); err != nil {
+			fail("%s.framerate: %v", key, err)
+		}
+	}
+
+	if s.Resolution != "" {
+		if _, _, err := streaming.ParseResolution(s.Resolution); err != nil {
+			fail("%s.resolution: %v", key, err)
+		}
+	}
+
+	if err := streaming.ValidateOverlay(s.Overlay); err != nil {
+		fail("%s.overlay: %v", key, err)
+	}
+	if s.Overlay.Enabled && s.FontPath != "" {
+		if _, err := os.Stat(s.FontPath); err != nil {
+			fail("%s.font_path: %v", key, err)
+		}
+	}
+
+	if r := s.Restart; r.MaxRestarts < 0 || r.BackoffSec < 0 || r.MaxBackoffSec < 0 || r.StableSec < 0 {
+		fail("%s.restart values must not be negative", key)
+	}
+
+	if idle := s.Idle; idle.Enabled {
+		if idle.URLTemplate == "" {
+			fail("%s.idle.url_template is required when the idle screen is enabled", key)
+		} else if _, err := streaming.RentalURL(idle.URLTemplate, "device"); err != nil {
+			fail("%s.idle.url_template: %v", key, err)
+		}
+		if s.QRPath == "" {
+			fail("%s.qr_path is required when the idle screen is enabled", key)
+		}
+		for name, c := range map[string]string{"background_color": idle.BackgroundColor, "text_color": idle.TextColor} {
+			if _, err := streaming.ParseColor(c); c != "" && err != nil {
+				fail("%s.idle.%s: %v", key, name, err)
+			}
+		}
+	}
+
+	if s.ConnectorID != "" {
+		if _, err := strconv.ParseUint(s.ConnectorID, 10, 32); err != nil {
+			fail("%s.connector_id must be a number, got %q", key, s.ConnectorID)
+		}
+	}
+
+	if snap := s.Snapshot; snap.Quality < 1 || snap.Quality > 100 {
+		fail("%s.snapshot.quality must be between 1 and 100", key)
+	} else if snap.MaxFiles < 0 {
+		fail("%s.snapshot.max_files must not be negative", key)
+	} else if snap.Dir == "" {
+		fail("%s.snapshot.dir is required", key)
+	}
+
+	if err := streaming.ValidateTransform(s.Transform); err != nil {
+		fail("%s.transform: %v", key, err)
+	}
+
+	if err := streaming.ValidateRecording(s.Recording); err != nil {
+		fail("%s.recording: %v", key, err)
+	}
+
+	if err := streaming.ValidatePreview(s.Preview); err != nil {
+		fail("%s.preview: %v", key, err)
+	}
+
+	if err := streaming.ValidateNetwork(s.Network); err != nil {
+		fail("%s.network: %v", key, err)
+	}
+
+	if err := streaming.ValidateAudio(s.Audio); err != nil {
+		fail("%s.audio: %v", key, err)
+	}
+}
+
+// connectorKey - выбранный коннектор потока для проверки пересечений.
+func connectorKey(s *models.StreamConfig) string {
+	if s.Connector != "" {
+		return strings.ToLower(s.Connector)
+	}
+	return s.ConnectorID
+}
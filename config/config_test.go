@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFileStreamsInherit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+		"stream": {
+			"device": "/dev/video0",
+			"resolution": "1280x720",
+			"templates": {"custom": "videotestsrc ! kmssink"},
+			"overlay": {"message": "main"}
+		},
+		"streams": [
+			{"name": "cam2", "device": "/dev/video2", "templates": {"other": "fakesink"}},
+			{"name": "cam3", "device": "/dev/video4", "temp_dir": "/run/cam3", "overlay": {"message": "third"}}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	if err := loadFile(path, cfg); err != nil {
+		t.Fatalf("loadFile() error: %v", err)
+	}
+	if len(cfg.Streams) != 2 {
+		t.Fatalf("len(Streams) = %d, want 2", len(cfg.Streams))
+	}
+
+	cam2, cam3 := cfg.Streams[0], cfg.Streams[1]
+	if cam2.Device != "/dev/video2" || cam3.Device != "/dev/video4" {
+		t.Errorf("own fields not applied: %q, %q", cam2.Device, cam3.Device)
+	}
+	if cam2.Resolution != "1280x720" || cam2.Overlay.Message != "main" {
+		t.Errorf("stream fields not inherited: resolution %q, overlay %q", cam2.Resolution, cam2.Overlay.Message)
+	}
+	// вложенная секция наследуется целиком, заданные поля накладываются поверх
+	if cam3.Overlay.Message != "third" || cam3.Overlay.FontSize != cfg.Stream.Overlay.FontSize {
+		t.Errorf("cam3 overlay = %+v", cam3.Overlay)
+	}
+
+	if cam2.TempDir != filepath.Join(cfg.Stream.TempDir, "cam2") || cam2.QRPath != filepath.Join(cam2.TempDir, "qr.png") {
+		t.Errorf("cam2 work files not separated: %q, %q", cam2.TempDir, cam2.QRPath)
+	}
+	if cam3.TempDir != "/run/cam3" || cam3.QRPath != "/run/cam3/qr.png" {
+		t.Errorf("cam3 work files: %q, %q", cam3.TempDir, cam3.QRPath)
+	}
+
+	// карты копируются: шаблоны потока не попадают в секцию stream
+	if cam2.Templates["custom"] == "" || cam2.Templates["other"] == "" {
+		t.Errorf("cam2 templates = %v", cam2.Templates)
+	}
+	if _, ok := cfg.Stream.Templates["other"]; ok {
+		t.Errorf("stream templates modified by streams[0]: %v", cfg.Stream.Templates)
+	}
+}
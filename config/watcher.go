@@ -0,0 +1,141 @@
+// config/watcher.go
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"rentiga-device/models"
+)
+
+// Watcher перечитывает файл конфигурации по SIGHUP или при изменении файла на диске.
+type Watcher struct {
+	Path     string
+	Interval time.Duration
+
+	// OnChange получает новую валидную конфигурацию, OnError - ошибку загрузки.
+	OnChange func(*models.AppConfig)
+	OnError  func(error)
+
+	modTime time.Time
+	size    int64
+}
+
+func NewWatcher(path string, onChange func(*models.AppConfig), onError func(error)) *Watcher {
+	return &Watcher{
+		Path:     path,
+		Interval: 5 * time.Second,
+		OnChange: onChange,
+		OnError:  onError,
+	}
+}
+
+// Run блокируется, поэтому запускается в отдельной горутине.
+func (w *Watcher) Run() {
+	w.modTime, w.size = w.stat()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			log.Printf("SIGHUP received, reloading %s", w.Path)
+			w.modTime, w.size = w.stat()
+			w.reload()
+		case <-ticker.C:
+			modTime, size := w.stat()
+			if modTime.Equal(w.modTime) && size == w.size {
+				continue
+			}
+			w.modTime, w.size = modTime, size
+			log.Printf("Config file %s changed, reloading", w.Path)
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) stat() (time.Time, int64) {
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+func (w *Watcher) reload() {
+	cfg, err := Load(w.Path)
+	if err != nil {
+		log.Printf("Config reload failed: %v", err)
+		if w.OnError != nil {
+			w.OnError(err)
+		}
+		return
+	}
+	if w.OnChange != nil {
+		w.OnChange(cfg)
+	}
+}
+
+// Diff возвращает пути (по json-тегам, например "stream.device") всех полей,
+// значения которых отличаются в old и new. Элементы streams сравниваются по
+// отдельности ("streams.cam2.device"), если их состав не изменился, иначе
+// меняется весь "streams".
+func Diff(old, new *models.AppConfig) []string {
+	var changed []string
+	diffValues(reflect.ValueOf(*old), reflect.ValueOf(*new), "", &changed)
+	return changed
+}
+
+func diffValues(a, b reflect.Value, prefix string, changed *[]string) {
+	if streams, ok := a.Interface().([]models.StreamConfig); ok {
+		diffStreams(streams, b.Interface().([]models.StreamConfig), prefix, changed)
+		return
+	}
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*changed = append(*changed, prefix)
+		}
+		return
+	}
+
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		diffValues(a.Field(i), b.Field(i), name, changed)
+	}
+}
+
+// diffStreams сравнивает элементы streams по именам. Добавить, убрать или
+// переставить поток можно только перезапуском агента.
+func diffStreams(old, new []models.StreamConfig, prefix string, changed *[]string) {
+	same := len(old) == len(new)
+	for i := 0; same && i < len(old); i++ {
+		same = old[i].Name == new[i].Name
+	}
+	if !same {
+		*changed = append(*changed, prefix)
+		return
+	}
+	for i := range old {
+		diffValues(reflect.ValueOf(old[i]), reflect.ValueOf(new[i]), prefix+"."+old[i].Name, changed)
+	}
+}
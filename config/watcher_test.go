@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"rentiga-device/models"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*models.AppConfig)
+		want   []string
+	}{
+		{"no changes", func(*models.AppConfig) {}, nil},
+		{"top-level field", func(c *models.AppConfig) { c.Web.Port = ":9999" }, []string{"web.port"}},
+		{"nested struct", func(c *models.AppConfig) { c.Stream.Overlay.Message = "hello" }, []string{"stream.overlay.message"}},
+		{"several fields", func(c *models.AppConfig) {
+			c.Stream.Device = "/dev/video2"
+			c.Broker.URI = "amqp://other/"
+		}, []string{"stream.device", "broker.uri"}},
+		{"map compared as a whole", func(c *models.AppConfig) {
+			c.Stream.Variables = map[string]string{"queue_size": "5"}
+		}, []string{"stream.variables"}},
+		{"stream added", func(c *models.AppConfig) {
+			c.Streams = append(c.Streams, models.StreamConfig{Name: "third"})
+		}, []string{"streams"}},
+		{"stream renamed", func(c *models.AppConfig) {
+			c.Streams[0].Name = "other"
+		}, []string{"streams"}},
+		{"stream element field", func(c *models.AppConfig) {
+			c.Streams[0].Device = "/dev/video4"
+			c.Streams[0].Overlay.Message = "hello"
+		}, []string{"streams.second.device", "streams.second.overlay.message"}},
+		{"only stream changed", func(c *models.AppConfig) {
+			c.Stream.Resolution = "1280x720"
+		}, []string{"stream.resolution"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, new := Default(), Default()
+			old.Streams = []models.StreamConfig{{Name: "second", Device: "/dev/video2"}}
+			new.Streams = []models.StreamConfig{{Name: "second", Device: "/dev/video2"}}
+			tt.change(new)
+			if got := Diff(old, new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@ require (
 	github.com/pierrec/lz4/v4 v4.1.2 // indirect
 	github.com/ulikunitz/xz v0.5.9 // indirect
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
+	golang.org/x/text v0.23.0 // indirect
 )
 
 require (
@@ -22,4 +23,5 @@ require (
 	github.com/mholt/archiver/v3 v3.5.1
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/streadway/amqp v1.1.0
+	golang.org/x/image v0.25.0
 )
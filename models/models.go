@@ -1,31 +1,240 @@
 package models
 
+import "time"
+
 type AppConfig struct {
-    Certificate CertificateConfig
-    Stream      StreamConfig
-	Web WebConfig
+    Certificate CertificateConfig `json:"certificate"`
+    Stream      StreamConfig      `json:"stream"`
+    Streams     []StreamConfig    `json:"streams"` // дополнительные потоки, наследуют stream
+	Web         WebConfig         `json:"web"`
+	Broker      BrokerConfig      `json:"broker"`
+	Backend     BackendConfig     `json:"backend"`
 }
 
 type CertificateConfig struct {
-    CertPath    string
-    KeyPath     string
-    CaPath      string
-    DeviceID    string
-    TempDir     string
+    CertPath    string `json:"cert_path"`
+    KeyPath     string `json:"key_path"`
+    CaPath      string `json:"ca_path"`
+    DeviceID    string `json:"-"` // берется из CN сертификата
+    TempDir     string `json:"temp_dir"`
 }
 
 type StreamConfig struct {
-    Device      string
-    Resolution  string
-    FontPath    string
-    TempDir     string
-    QRPath      string
-    ConnectorID string 
+    Name        string `json:"name,omitempty"` // только для элементов streams
+    Device      string `json:"device"`
+    Resolution  string `json:"resolution"`
+    FontPath    string `json:"font_path"`
+    TempDir     string `json:"temp_dir"`
+    QRPath      string `json:"qr_path"`
+    ConnectorID string `json:"connector_id"`
+    Connector   string `json:"connector"` // имя коннектора (HDMI-A-1), важнее connector_id
+
+    // Backend - gstreamer (по умолчанию), ffmpeg или test, см. streaming.PipelineFor
+    Backend      string `json:"backend"`
+    FFmpegOutput string `json:"ffmpeg_output"` // framebuffer (по умолчанию /dev/fb0) или "sdl"
+    TestOutput   string `json:"test_output"`   // файл для бэкенда test; пусто - fakesink
+
+    // Шаблон пайплайна gstreamer: имя из Templates или встроенного набора (streaming.Templates)
+    Template  string            `json:"template"`
+    Templates map[string]string `json:"templates"`
+    Framerate string            `json:"framerate"` // например "30/1"
+    Caps      string            `json:"caps"`      // caps источника, переопределяют значение шаблона
+    Decoder   string            `json:"decoder"`   // auto, vaapi, v4l2 или software - для шаблонов с {{.Decoder}}
+    Variables map[string]string `json:"variables"` // произвольные переменные, {{var "name" "default"}}
+
+    // FrameTap - отвод кадров из пайплайна для снимков, превью и записи
+    FrameTap bool `json:"frame_tap"`
+
+    // MeasureLatency включает трейсер latency GStreamer; заметно нагружает слабые CPU
+    MeasureLatency bool `json:"measure_latency"`
+    // MeasureQueueDrops включает отладочный вывод очередей, чтобы считать выброшенные ими буферы
+    MeasureQueueDrops bool `json:"measure_queue_drops"`
+
+    Transform TransformConfig `json:"transform"`
+    Overlay   OverlayConfig   `json:"overlay"`
+    Idle      IdleConfig      `json:"idle"`
+    Restart   RestartConfig   `json:"restart"`
+    Snapshot  SnapshotConfig  `json:"snapshot"`
+    Recording RecordingConfig `json:"recording"`
+    Preview   PreviewConfig   `json:"preview"`
+    Network   NetworkConfig   `json:"network"`
+    Audio     AudioConfig     `json:"audio"`
+}
+
+// AudioConfig - передача звука с устройства захвата на выход. Громкость и mute
+// можно менять на лету через API или командой audio.
+type AudioConfig struct {
+	Enabled bool    `json:"enabled"`
+	Input   string  `json:"input"`  // ALSA-устройство (hw:1,0) или "auto" - звук карты захвата
+	Output  string  `json:"output"` // ALSA-устройство (hdmi:CARD=vc4hdmi0), "pulse" или пусто - по умолчанию
+	Volume  float64 `json:"volume"` // 1.0 - без изменений
+	Mute    bool    `json:"mute"`
+}
+
+// AudioUpdate - частичное изменение звука: nil-поля остаются как есть.
+type AudioUpdate struct {
+	Enabled *bool    `json:"enabled,omitempty"`
+	Volume  *float64 `json:"volume,omitempty"`
+	Mute    *bool    `json:"mute,omitempty"`
+}
+
+// TransformConfig - преобразование кадра перед выводом: сначала обрезка
+// (в координатах кадра с устройства), затем поворот по часовой стрелке и отражения,
+// затем масштабирование. Плашка рисуется уже поверх результата.
+type TransformConfig struct {
+	Rotate         int        `json:"rotate"` // 0, 90, 180 или 270
+	FlipHorizontal bool       `json:"flip_horizontal"`
+	FlipVertical   bool       `json:"flip_vertical"`
+	Crop           CropConfig `json:"crop"`
+	Scale          string     `json:"scale"` // "" - без масштабирования, "fit" - с полями, "stretch"
+	Width          int        `json:"width"` // размер после масштабирования
+	Height         int        `json:"height"`
+}
+
+// CropConfig - сколько пикселей срезать с каждой стороны (например, черные рамки источника).
+type CropConfig struct {
+	Left   int `json:"left"`
+	Right  int `json:"right"`
+	Top    int `json:"top"`
+	Bottom int `json:"bottom"`
+}
+
+// NetworkConfig - сетевой вывод трансляции параллельно с локальным экраном.
+type NetworkConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Protocol       string `json:"protocol"` // hls или rtsp
+	Dir            string `json:"dir"`      // сегменты HLS, отдаются веб-сервером по /api/hls/
+	RTSPURL        string `json:"rtsp_url"` // внешний RTSP-сервер, куда публикуется поток (например, mediamtx); сам агент RTSP не раздает
+	Width          int    `json:"width"`    // 0 - размер захвата
+	Encoder        string `json:"encoder"`  // auto, vaapi или x264
+	BitrateKbps    int    `json:"bitrate_kbps"`
+	SegmentSec     int    `json:"segment_sec"`
+	PlaylistLength int    `json:"playlist_length"`
+}
+
+// PreviewConfig - уменьшенный MJPEG-поток /api/preview.
+type PreviewConfig struct {
+	Width      int    `json:"width"`     // высота подбирается с сохранением пропорций
+	Framerate  string `json:"framerate"` // например "5/1"
+	Quality    int    `json:"quality"`
+	MaxViewers int    `json:"max_viewers"` // 0 - без ограничения
+}
+
+// RecordingConfig - запись трансляции в сегменты с ограничением по месту и возрасту.
+type RecordingConfig struct {
+	AutoStart   bool   `json:"auto_start"` // писать всегда, пока идет поток
+	Dir         string `json:"dir"`
+	Format      string `json:"format"`  // mp4 или mkv
+	Encoder     string `json:"encoder"` // auto, vaapi или x264
+	SegmentSec  int    `json:"segment_sec"`
+	BitrateKbps int    `json:"bitrate_kbps"`
+	MaxSizeMB   int    `json:"max_size_mb"`   // 0 - без ограничения
+	MaxAgeHours int    `json:"max_age_hours"` // 0 - без ограничения
+}
+
+// SnapshotConfig - куда и сколько хранить снимки экрана.
+type SnapshotConfig struct {
+	Dir      string `json:"dir"`
+	MaxFiles int    `json:"max_files"` // старые снимки удаляются; 0 - без ограничения
+	Quality  int    `json:"quality"`   // качество JPEG, 1-100
+}
+
+// RestartConfig - политика перезапуска упавшего пайплайна.
+type RestartConfig struct {
+	MaxRestarts   int `json:"max_restarts"`    // подряд, до перехода в состояние failed
+	BackoffSec    int `json:"backoff_sec"`     // первая задержка, дальше удваивается
+	MaxBackoffSec int `json:"max_backoff_sec"`
+	StableSec     int `json:"stable_sec"` // после стольких секунд работы счетчик перезапусков сбрасывается
+}
+
+// IdleConfig - заставка с QR-кодом аренды, которая показывается, пока поток не запущен.
+type IdleConfig struct {
+	Enabled         bool   `json:"enabled"`
+	URLTemplate     string `json:"url_template"` // например "https://rentiga.ru/rent/{{.DeviceID}}"
+	LogoPath        string `json:"logo_path"`    // PNG или JPEG
+	StatusText      string `json:"status_text"`
+	QRSize          int    `json:"qr_size"` // в пикселях, по умолчанию половина высоты экрана
+	BackgroundColor string `json:"background_color"`
+	TextColor       string `json:"text_color"`
+}
+
+// OverlayConfig - текстовая плашка поверх видео. Текст и режим можно менять
+// на лету командой overlay, без перезапуска пайплайна.
+type OverlayConfig struct {
+	Enabled         bool   `json:"enabled"`
+	Mode            string `json:"mode"`             // "clock", "session" (остаток времени сеанса) или "message"
+	Message         string `json:"message"`          // текст для режима "message"
+	ClockFormat     string `json:"clock_format"`     // формат времени Go, по умолчанию "15:04:05"
+	Position        string `json:"position"`         // "top-left", "top", "top-right", "center", "bottom-left", "bottom", "bottom-right"
+	FontSize        int    `json:"font_size"`        // в пикселях
+	Color           string `json:"color"`            // "#RRGGBB" или "#RRGGBBAA"
+	BackgroundColor string `json:"background_color"` // пустое значение - без подложки
 }
 
 type CommandMessage struct {
 	DeviceID string `json:"device_id"`
-	Action   string `json:"action"` // "start" или "stop"
+	Action   string `json:"action"` // "start", "stop", "start_session", "extend_session", "end_session"
+	// Имя потока из streams для start, stop, snapshot и transform; пусто - основной поток.
+	// Запись, плашка и звук есть только у основного потока: другое имя - ошибка
+	Stream   string `json:"stream,omitempty"`
+
+	// Параметры сеанса аренды. Длительность задается либо DurationSec, либо ExpiresAt;
+	// для extend_session DurationSec добавляется к текущему времени окончания.
+	SessionID   string     `json:"session_id,omitempty"`
+	Customer    string     `json:"customer,omitempty"`
+	DurationSec int        `json:"duration_sec,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+
+	Overlay   *OverlayUpdate   `json:"overlay,omitempty"`   // для действия "overlay"
+	Transform *TransformConfig `json:"transform,omitempty"` // для действия "transform"
+	Audio     *AudioUpdate     `json:"audio,omitempty"`     // для действия "audio"
+}
+
+// OverlayUpdate - частичное изменение плашки: nil-поля остаются как есть.
+type OverlayUpdate struct {
+	Enabled *bool   `json:"enabled,omitempty"`
+	Mode    *string `json:"mode,omitempty"`
+	Message *string `json:"message,omitempty"`
+}
+
+// SessionInfo - сеанс аренды: состояние для статуса и для сохранения между перезапусками.
+type SessionInfo struct {
+	ID           string    `json:"session_id"`
+	Customer     string    `json:"customer,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RemainingSec int       `json:"remaining_sec"`
+}
+
+// CommandResult отправляется в очередь ReplyTo команды с тем же CorrelationId.
+type CommandResult struct {
+	DeviceID  string    `json:"device_id"`
+	Action    string    `json:"action"`
+	Status    string    `json:"status"` // "ok" или "error"
+	Error     string    `json:"error,omitempty"`
+	Streaming bool      `json:"streaming"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Session  *SessionInfo  `json:"session,omitempty"`
+	Snapshot *SnapshotInfo `json:"snapshot,omitempty"`
+}
+
+// SnapshotInfo - снятый кадр.
+type SnapshotInfo struct {
+	File     string    `json:"file"`
+	Stream   string    `json:"stream,omitempty"` // для дополнительных потоков
+	TakenAt  time.Time `json:"taken_at"`
+	Size     int64     `json:"size"`
+	Source   string    `json:"source"` // pipeline или device
+	Uploaded bool      `json:"uploaded"`
+}
+
+// DeviceEvent публикуется в exchange событий с ключом device.<id>.event.<type>.
+type DeviceEvent struct {
+	DeviceID  string                 `json:"device_id"`
+	Type      string                 `json:"type"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
 }
 
 type WebAuthConfig struct {
@@ -36,4 +245,16 @@ type WebAuthConfig struct {
 type WebConfig struct {
     Port string        `json:"port"`
     Auth WebAuthConfig `json:"auth"`
-}
\ No newline at end of file
+}
+
+type BrokerConfig struct {
+	URI                string `json:"uri"`
+	CommandExchange    string `json:"command_exchange"`
+	DeadLetterExchange string `json:"dead_letter_exchange"` // пустое значение - отклоненные команды отбрасываются
+	EventExchange      string `json:"event_exchange"`
+	StatusInterval     int    `json:"status_interval_sec"`
+}
+
+type BackendConfig struct {
+	BaseURL string `json:"base_url"`
+}
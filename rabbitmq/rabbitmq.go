@@ -2,43 +2,301 @@
 package rabbitmq
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
 
+type State string
+
+const (
+	StateConnecting   State = "connecting"
+	StateConnected    State = "connected"
+	StateReconnecting State = "reconnecting"
+	StateClosed       State = "closed"
+)
+
+var ErrNotConnected = errors.New("not connected to RabbitMQ")
+
+const (
+	minBackoff = 1 * time.Second
+	maxBackoff = 60 * time.Second
+)
+
 type Client struct {
+	uri     string
 	conn    *amqp.Connection
 	channel *amqp.Channel
+	mu      sync.Mutex
+
+	state     State
+	lastError string
+	queues    map[string]struct{}
+	exchanges map[string]string // имя -> тип, объявленные при публикации
+	consumers []*consumer
+	done      chan struct{}
+	wake      chan struct{}
+}
+
+// consumer переживает переподключения: после каждого нового соединения
+// подписка восстанавливается, а доставки продолжают приходить в тот же out.
+type consumer struct {
+	binding    Binding
+	tag        string
+	out        chan amqp.Delivery
+	forwarders int // горутины, пересылающие доставки (старого и нового соединения)
+	cancelled  bool
 }
 
+// New пытается подключиться сразу, но не считает недоступность брокера фатальной:
+// при ошибке подключение продолжается в фоне с экспоненциальной задержкой.
 func New(uri string) (*Client, error) {
+	if _, err := amqp.ParseURI(uri); err != nil {
+		return nil, fmt.Errorf("invalid RabbitMQ URI: %v", err)
+	}
+
+	c := &Client{
+		uri:       uri,
+		state:     StateConnecting,
+		queues:    make(map[string]struct{}),
+		exchanges: make(map[string]string),
+		done:      make(chan struct{}),
+		wake:      make(chan struct{}, 1),
+	}
+
+	if err := c.connect(); err != nil {
+		log.Printf("RabbitMQ unavailable, will retry in background: %v", err)
+		c.mu.Lock()
+		c.state = StateReconnecting
+		c.lastError = err.Error()
+		c.mu.Unlock()
+		c.trigger()
+	}
+
+	go c.reconnectLoop()
+	return c, nil
+}
+
+func dial(uri string) (*amqp.Connection, *amqp.Channel, error) {
 	conn, err := amqp.Dial(uri)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
 	}
 
 	channel, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %v", err)
+		return nil, nil, fmt.Errorf("failed to open channel: %v", err)
 	}
+	return conn, channel, nil
+}
+
+// connect устанавливает соединение по текущему uri, заново объявляет очереди и
+// восстанавливает всех потребителей. Старое соединение закрывается только после успеха.
+func (c *Client) connect() error {
+	c.mu.Lock()
+	uri := c.uri
+	c.mu.Unlock()
 
-	return &Client{conn, channel}, nil
+	conn, channel, err := dial(uri)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for queue := range c.queues {
+		if err := declareQueue(channel, queue, nil); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	for name, kind := range c.exchanges {
+		if err := declareExchange(channel, name, kind); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	for _, cons := range c.consumers {
+		if err := c.subscribe(channel, cons); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	oldConn := c.conn
+	c.conn, c.channel = conn, channel
+	c.state = StateConnected
+	c.lastError = ""
+
+	if oldConn != nil {
+		oldConn.Close()
+	}
+
+	// подписываемся на закрытие сразу, чтобы не пропустить обрыв до старта горутины
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chanClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+	go c.watch(conn, connClosed, chanClosed)
+	return nil
 }
 
-func (c *Client) Publish(queue string, body []byte) error {
-	_, err := c.channel.QueueDeclare(
+// watch ждет закрытия соединения или канала. Штатное закрытие (Close, Reconnect)
+// приходит без ошибки и переподключения не вызывает.
+func (c *Client) watch(conn *amqp.Connection, connClosed, chanClosed <-chan *amqp.Error) {
+	var amqpErr *amqp.Error
+	select {
+	case amqpErr = <-connClosed:
+	case amqpErr = <-chanClosed:
+	}
+	if amqpErr == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.conn != conn || c.state == StateClosed {
+		c.mu.Unlock()
+		return
+	}
+	log.Printf("RabbitMQ connection lost: %v", amqpErr)
+	c.state = StateReconnecting
+	c.lastError = amqpErr.Error()
+	c.mu.Unlock()
+
+	// закрытый канал при живом соединении тоже лечим полным переподключением
+	conn.Close()
+	c.trigger()
+}
+
+func (c *Client) trigger() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) reconnectLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.wake:
+		}
+
+		for attempt := 0; ; attempt++ {
+			if c.State() != StateReconnecting {
+				break
+			}
+
+			delay := backoff(attempt)
+			select {
+			case <-c.done:
+				return
+			case <-time.After(delay):
+			}
+
+			if err := c.connect(); err != nil {
+				log.Printf("RabbitMQ reconnect attempt %d failed: %v", attempt+1, err)
+				c.mu.Lock()
+				c.lastError = err.Error()
+				c.mu.Unlock()
+				continue
+			}
+			log.Println("Reconnected to RabbitMQ")
+			break
+		}
+	}
+}
+
+// backoff - экспоненциальная задержка с джиттером в диапазоне [d/2, d).
+func backoff(attempt int) time.Duration {
+	d := minBackoff << uint(attempt)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// Reconnect переключает клиента на новый URI. Потребители переподписываются автоматически.
+func (c *Client) Reconnect(uri string) error {
+	if _, err := amqp.ParseURI(uri); err != nil {
+		return fmt.Errorf("invalid RabbitMQ URI: %v", err)
+	}
+
+	c.mu.Lock()
+	oldURI := c.uri
+	c.uri = uri
+	c.mu.Unlock()
+
+	if err := c.connect(); err != nil {
+		c.mu.Lock()
+		c.uri = oldURI
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (c *Client) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+func (c *Client) Connected() bool {
+	return c.State() == StateConnected
+}
+
+// Status возвращает состояние подключения для API статуса.
+func (c *Client) Status() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := map[string]interface{}{
+		"state":     c.state,
+		"connected": c.state == StateConnected,
+	}
+	if c.lastError != "" {
+		status["last_error"] = c.lastError
+	}
+	return status
+}
+
+func declareQueue(channel *amqp.Channel, queue string, args amqp.Table) error {
+	_, err := channel.QueueDeclare(
 		queue,  // name
 		true,   // durable
 		false,  // delete when unused
 		false,  // exclusive
 		false,  // no-wait
-		nil,    // arguments
+		args,   // arguments
 	)
 	if err != nil {
 		return fmt.Errorf("failed to declare queue: %v", err)
 	}
+	return nil
+}
+
+func (c *Client) Publish(queue string, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateConnected {
+		return ErrNotConnected
+	}
+
+	if err := declareQueue(c.channel, queue, nil); err != nil {
+		return err
+	}
+	c.queues[queue] = struct{}{}
 
 	return c.channel.Publish(
 		"",     // exchange
@@ -52,19 +310,301 @@ func (c *Client) Publish(queue string, body []byte) error {
 	)
 }
 
+// Binding описывает очередь, привязанную к exchange по ключу маршрутизации.
+// Пустой Exchange означает обычную очередь без привязки.
+type Binding struct {
+	Exchange     string
+	ExchangeKind string // "direct" или "topic"
+	Queue        string
+	RoutingKey   string
+
+	// ManualAck отключает auto-ack: доставку нужно подтвердить Ack/Nack или DeadLetter.
+	ManualAck bool
+	// DeadLetterExchange объявляется при подписке и используется DeadLetter. В аргументы
+	// очереди он не попадает: durable-очередь с другими аргументами брокер не переобъявит
+	// (406 PRECONDITION_FAILED), а exchange может смениться при перезагрузке конфига.
+	// Если нужен dead-lettering на стороне брокера, его задают политикой RabbitMQ.
+	DeadLetterExchange string
+}
+
+// PublishExchange публикует сообщение в exchange (объявляя его при первой публикации).
+// Сообщения не сохраняются: пока брокер недоступен, возвращается ErrNotConnected.
+func (c *Client) PublishExchange(exchange, kind, routingKey string, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateConnected {
+		return ErrNotConnected
+	}
+
+	if _, ok := c.exchanges[exchange]; !ok {
+		if err := declareExchange(c.channel, exchange, kind); err != nil {
+			return err
+		}
+		c.exchanges[exchange] = kind
+	}
+
+	return c.channel.Publish(
+		exchange,    // exchange
+		routingKey,  // routing key
+		false,       // mandatory
+		false,       // immediate
+		amqp.Publishing{
+			ContentType: "application/json",
+			Timestamp:   time.Now(),
+			Body:        body,
+		},
+	)
+}
+
+// Consume возвращает канал доставок, который не закрывается при обрыве связи с брокером.
+// Если брокер сейчас недоступен, подписка будет оформлена после переподключения.
 func (c *Client) Consume(queue string) (<-chan amqp.Delivery, error) {
-	return c.channel.Consume(
-		queue,  // queue
-		"",     // consumer
-		true,   // auto-ack
-		false,  // exclusive
-		false,  // no-local
+	return c.ConsumeBinding(Binding{Queue: queue})
+}
+
+// ConsumeBinding объявляет exchange и очередь, связывает их и подписывается на очередь.
+// Вся топология объявляется заново после каждого переподключения.
+func (c *Client) ConsumeBinding(b Binding) (<-chan amqp.Delivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateClosed {
+		return nil, errors.New("client is closed")
+	}
+
+	cons := &consumer{
+		binding: b,
+		tag:     fmt.Sprintf("rentiga-%s", b.Queue),
+		out:     make(chan amqp.Delivery),
+	}
+	if c.state == StateConnected {
+		if err := c.subscribe(c.channel, cons); err != nil {
+			return nil, err
+		}
+	}
+
+	c.consumers = append(c.consumers, cons)
+	return cons.out, nil
+}
+
+// Unsubscribe отменяет подписку на очередь. Канал доставок этой подписки закрывается.
+func (c *Client) Unsubscribe(queue string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	kept := c.consumers[:0]
+	for _, cons := range c.consumers {
+		if cons.binding.Queue != queue {
+			kept = append(kept, cons)
+			continue
+		}
+
+		cons.cancelled = true
+		if cons.forwarders == 0 {
+			close(cons.out)
+			continue
+		}
+		// out закроет горутина пересылки, когда amqp закроет канал доставок
+		if cancelErr := c.channel.Cancel(cons.tag, false); cancelErr != nil {
+			err = fmt.Errorf("failed to cancel consumer %s: %v", cons.tag, cancelErr)
+		}
+	}
+	c.consumers = kept
+	return err
+}
+
+func declareExchange(channel *amqp.Channel, name, kind string) error {
+	if kind == "" {
+		kind = amqp.ExchangeDirect
+	}
+	if err := channel.ExchangeDeclare(
+		name,   // name
+		kind,   // type
+		true,   // durable
+		false,  // auto-deleted
+		false,  // internal
 		false,  // no-wait
-		nil,    // args
+		nil,    // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %v", name, err)
+	}
+	return nil
+}
+
+func declareBinding(channel *amqp.Channel, b Binding) error {
+	if b.Exchange == "" {
+		return nil
+	}
+
+	if err := declareExchange(channel, b.Exchange, b.ExchangeKind); err != nil {
+		return err
+	}
+
+	if err := channel.QueueBind(
+		b.Queue,       // queue
+		b.RoutingKey,  // routing key
+		b.Exchange,    // exchange
+		false,         // no-wait
+		nil,           // arguments
+	); err != nil {
+		return fmt.Errorf("failed to bind queue %s to %s: %v", b.Queue, b.Exchange, err)
+	}
+	return nil
+}
+
+// subscribe вызывается под c.mu.
+func (c *Client) subscribe(channel *amqp.Channel, cons *consumer) error {
+	if dlx := cons.binding.DeadLetterExchange; dlx != "" {
+		if err := declareExchange(channel, dlx, amqp.ExchangeTopic); err != nil {
+			return err
+		}
+	}
+
+	if err := declareQueue(channel, cons.binding.Queue, nil); err != nil {
+		return err
+	}
+	if err := declareBinding(channel, cons.binding); err != nil {
+		return err
+	}
+
+	deliveries, err := channel.Consume(
+		cons.binding.Queue,       // queue
+		cons.tag,                 // consumer
+		!cons.binding.ManualAck,  // auto-ack
+		false,                    // exclusive
+		false,                    // no-local
+		false,                    // no-wait
+		nil,                      // args
 	)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s: %v", cons.binding.Queue, err)
+	}
+
+	cons.forwarders++
+	go c.forward(cons, deliveries)
+	return nil
+}
+
+func (c *Client) forward(cons *consumer, deliveries <-chan amqp.Delivery) {
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		cons.forwarders--
+		if cons.cancelled && cons.forwarders == 0 {
+			close(cons.out)
+		}
+	}()
+
+	for d := range deliveries {
+		select {
+		case cons.out <- d:
+		case <-c.done:
+			return
+		}
+	}
 }
 
+// Reply отправляет ответ в очередь replyTo через exchange по умолчанию.
+// Очередь ответов принадлежит отправителю команды, поэтому здесь она не объявляется.
+func (c *Client) Reply(replyTo, correlationID string, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateConnected {
+		return ErrNotConnected
+	}
+
+	return c.channel.Publish(
+		"",       // exchange
+		replyTo,  // routing key
+		false,    // mandatory
+		false,    // immediate
+		amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: correlationID,
+			Timestamp:     time.Now(),
+			Body:          body,
+		},
+	)
+}
+
+// DeadLetter публикует копию доставки в dead-letter exchange с причиной отказа
+// в заголовке x-reject-reason и подтверждает исходную доставку. Штатный механизм
+// x-dead-letter-exchange не позволяет добавить свои заголовки, поэтому копируем сами.
+// Без exchange доставка просто отклоняется без возврата в очередь.
+func (c *Client) DeadLetter(d amqp.Delivery, exchange, reason string) error {
+	if exchange == "" {
+		return d.Nack(false, false)
+	}
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers["x-reject-reason"] = reason
+	headers["x-rejected-at"] = time.Now().UTC().Format(time.RFC3339)
+	headers["x-original-exchange"] = d.Exchange
+	headers["x-original-routing-key"] = d.RoutingKey
+
+	c.mu.Lock()
+	if c.state != StateConnected {
+		c.mu.Unlock()
+		// доставка вернется в очередь после переподключения
+		return ErrNotConnected
+	}
+	err := c.channel.Publish(
+		exchange,      // exchange
+		d.RoutingKey,  // routing key
+		false,         // mandatory
+		false,         // immediate
+		amqp.Publishing{
+			Headers:       headers,
+			ContentType:   d.ContentType,
+			CorrelationId: d.CorrelationId,
+			ReplyTo:       d.ReplyTo,
+			MessageId:     d.MessageId,
+			Timestamp:     d.Timestamp,
+			Body:          d.Body,
+		},
+	)
+	c.mu.Unlock()
+
+	if err != nil {
+		// не смогли сохранить - возвращаем в очередь, повторная доставка снова попадет сюда
+		log.Printf("Failed to publish dead letter: %v", err)
+		return d.Nack(false, true)
+	}
+	return d.Ack(false)
+}
+
+// Close останавливает переподключение и закрывает соединение.
+// Каналы, выданные Consume, не закрываются.
 func (c *Client) Close() {
-	c.channel.Close()
-	c.conn.Close()
-}
\ No newline at end of file
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateClosed {
+		return
+	}
+	c.state = StateClosed
+	close(c.done)
+
+	if c.conn != nil {
+		c.channel.Close()
+		c.conn.Close()
+	}
+}
+
+// DeviceCommandBinding - персональная очередь команд устройства. Backend публикует
+// команду в exchange с ключом device.<id>.command, и ее получает только это устройство.
+func DeviceCommandBinding(exchange, deviceID string) Binding {
+	return Binding{
+		Exchange:     exchange,
+		ExchangeKind: amqp.ExchangeTopic,
+		Queue:        fmt.Sprintf("device.%s.commands", deviceID),
+		RoutingKey:   fmt.Sprintf("device.%s.command", deviceID),
+	}
+}
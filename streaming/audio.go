@@ -0,0 +1,264 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"rentiga-device/models"
+)
+
+const (
+	AudioAuto  = "auto"  // звуковая карта того же USB-устройства, что и захват видео
+	AudioPulse = "pulse" // вывод через PulseAudio вместо ALSA
+)
+
+const (
+	AudioStopped = "stopped"
+	AudioWaiting = "waiting" // запуск не удался, следующая попытка по backoff
+	AudioPlaying = "playing"
+)
+
+const audioStopTimeout = 3 * time.Second
+
+// AudioPassthrough передает звук с устройства захвата на выход HDMI отдельным
+// процессом gst-launch: видеопайплайн не меняется, а сбой звука не роняет картинку.
+// Громкость и mute применяются перезапуском процесса - это занимает доли секунды.
+type AudioPassthrough struct {
+	mu         sync.Mutex
+	config     models.AudioConfig
+	wanted     bool
+	video      string // устройство видео, по которому ищется звуковая карта для "auto"
+	input      string // ALSA-устройство, с которого идет звук
+	cmd        *exec.Cmd
+	done       chan struct{}
+	loopStop   chan struct{}
+	restarting bool // процесс остановлен намеренно, это не сбой
+	failures   int
+	launchedAt time.Time
+	retryAt    time.Time
+	lastError  string
+}
+
+func NewAudioPassthrough(cfg models.AudioConfig) *AudioPassthrough {
+	return &AudioPassthrough{config: cfg}
+}
+
+// Update меняет настройки; идущий процесс подхватит их после Restart.
+func (a *AudioPassthrough) Update(cfg models.AudioConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.config = cfg
+}
+
+// Start включает передачу звука; videoDevice нужен для stream.audio.input = "auto".
+func (a *AudioPassthrough) Start(videoDevice string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.video = videoDevice
+	if a.wanted {
+		return
+	}
+	a.wanted = true
+	a.failures = 0
+	a.retryAt = time.Time{}
+	a.lastError = ""
+	a.loopStop = make(chan struct{})
+	go a.loop(a.loopStop)
+}
+
+func (a *AudioPassthrough) Stop() {
+	a.mu.Lock()
+	if !a.wanted {
+		a.mu.Unlock()
+		return
+	}
+	a.wanted = false
+	close(a.loopStop)
+	cmd, done := a.cmd, a.done
+	a.mu.Unlock()
+
+	if cmd != nil {
+		stopProcess(cmd, done, audioStopTimeout)
+	}
+}
+
+// Restart перезапускает процесс с текущими настройками (громкость, mute, устройства).
+func (a *AudioPassthrough) Restart() {
+	a.mu.Lock()
+	cmd, done := a.cmd, a.done
+	a.restarting = true
+	a.failures = 0
+	a.retryAt = time.Time{}
+	a.lastError = ""
+	a.mu.Unlock()
+
+	if cmd != nil {
+		stopProcess(cmd, done, audioStopTimeout)
+	}
+	a.mu.Lock()
+	a.restarting = false
+	a.mu.Unlock()
+	a.tick()
+}
+
+func (a *AudioPassthrough) loop(stop chan struct{}) {
+	ticker := time.NewTicker(recorderPoll)
+	defer ticker.Stop()
+
+	a.tick()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			a.tick()
+		}
+	}
+}
+
+func (a *AudioPassthrough) tick() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.wanted || a.cmd != nil || time.Now().Before(a.retryAt) {
+		return
+	}
+
+	input, err := a.resolveInput()
+	if err != nil {
+		a.failed(err.Error())
+		return
+	}
+	a.input = input
+
+	cmd := exec.Command("gst-launch-1.0", a.pipelineArgs()...)
+	stderr := newTailBuffer(stderrTailLimit)
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		a.failed(fmt.Sprintf("failed to start audio: %v", err))
+		return
+	}
+
+	log.Printf("Audio passthrough from %s", input)
+	a.cmd = cmd
+	a.done = make(chan struct{})
+	a.launchedAt = time.Now()
+	go a.wait(cmd, a.done, stderr)
+}
+
+func (a *AudioPassthrough) wait(cmd *exec.Cmd, done chan struct{}, stderr *tailBuffer) {
+	err := cmd.Wait()
+
+	a.mu.Lock()
+	if a.cmd == cmd {
+		a.cmd = nil
+	}
+	if a.wanted && !a.restarting {
+		if time.Since(a.launchedAt) >= time.Minute {
+			a.failures = 0
+		}
+		a.failed(describeExit(err, stderr.String()))
+	}
+	a.mu.Unlock()
+	close(done)
+}
+
+// failed вызывается под mu.
+func (a *AudioPassthrough) failed(msg string) {
+	a.failures++
+	a.lastError = msg
+	a.retryAt = time.Now().Add(restartDelay(2, 60, a.failures-1))
+	log.Printf("Audio passthrough stopped: %s", msg)
+}
+
+// resolveInput вызывается под mu.
+func (a *AudioPassthrough) resolveInput() (string, error) {
+	if a.config.Input != "" && a.config.Input != AudioAuto {
+		return a.config.Input, nil
+	}
+	return captureSoundCard(a.video)
+}
+
+func (a *AudioPassthrough) pipelineArgs() []string {
+	cfg := a.config
+	args := []string{
+		"-q",
+		"alsasrc", fmt.Sprintf("device=%s", a.input),
+		"!", "queue", "max-size-time=200000000", "leaky=downstream",
+		"!", "audioconvert",
+		"!", "audioresample",
+		"!", "volume", fmt.Sprintf("volume=%.2f", cfg.Volume), fmt.Sprintf("mute=%t", cfg.Mute),
+		"!",
+	}
+	switch cfg.Output {
+	case AudioPulse:
+		return append(args, "pulsesink")
+	case "":
+		return append(args, "alsasink")
+	default:
+		return append(args, "alsasink", fmt.Sprintf("device=%s", cfg.Output))
+	}
+}
+
+// Status - состояние звука для API статуса.
+func (a *AudioPassthrough) Status() map[string]interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := AudioStopped
+	switch {
+	case a.wanted && a.cmd != nil:
+		state = AudioPlaying
+	case a.wanted:
+		state = AudioWaiting
+	}
+	status := map[string]interface{}{
+		"state":   state,
+		"enabled": a.config.Enabled,
+		"volume":  a.config.Volume,
+		"mute":    a.config.Mute,
+	}
+	if a.input != "" {
+		status["input"] = a.input
+	}
+	if a.config.Output != "" {
+		status["output"] = a.config.Output
+	}
+	if a.lastError != "" {
+		status["last_error"] = a.lastError
+	}
+	return status
+}
+
+// captureSoundCard находит ALSA-карту того же USB-устройства, что и карта захвата:
+// у HDMI-донглов видео и звук - разные интерфейсы одного устройства.
+func captureSoundCard(videoDevice string) (string, error) {
+	dev, err := filepath.EvalSymlinks(videoDevice)
+	if err != nil {
+		return "", fmt.Errorf("capture device %s not found: %v", videoDevice, err)
+	}
+	iface, err := filepath.EvalSymlinks(filepath.Join("/sys/class/video4linux", filepath.Base(dev), "device"))
+	if err != nil {
+		return "", fmt.Errorf("no sysfs entry for %s: %v", dev, err)
+	}
+	cards, _ := filepath.Glob(filepath.Join(filepath.Dir(iface), "*", "sound", "card*"))
+	if len(cards) == 0 {
+		return "", fmt.Errorf("capture device %s has no audio interface, set stream.audio.input", videoDevice)
+	}
+	return "hw:" + strings.TrimPrefix(filepath.Base(cards[0]), "card") + ",0", nil
+}
+
+// ValidateAudio проверяет настройки звука.
+func ValidateAudio(cfg models.AudioConfig) error {
+	if cfg.Volume < 0 || cfg.Volume > 10 {
+		return fmt.Errorf("volume must be between 0 and 10, got %g", cfg.Volume)
+	}
+	return nil
+}
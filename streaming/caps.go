@@ -0,0 +1,173 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// CaptureMode - согласованный с устройством режим захвата, попадает в caps источника.
+type CaptureMode struct {
+	FourCC    string `json:"fourcc,omitempty"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Framerate string `json:"framerate,omitempty"`
+}
+
+// gstFormats сопоставляет caps GStreamer форматам V4L2.
+var gstFormats = map[string]string{
+	"image/jpeg":              "MJPG",
+	"video/x-raw,format=YUY2": "YUYV",
+	"video/x-raw,format=UYVY": "UYVY",
+	"video/x-raw,format=NV12": "NV12",
+}
+
+// NegotiateMode подбирает режим устройства, ближайший к запрошенному: точное
+// совпадение размера, иначе ближайший по площади; частота - запрошенная или
+// ближайшая меньшая. Без данных об устройстве (dev == nil) возвращает запрошенное.
+func NegotiateMode(dev *VideoDevice, fourcc string, width, height int, framerate string) (CaptureMode, error) {
+	want := CaptureMode{FourCC: fourcc, Width: width, Height: height, Framerate: framerate}
+	if dev == nil {
+		return want, nil
+	}
+
+	var format *VideoFormat
+	supported := make([]string, 0, len(dev.Formats))
+	for i := range dev.Formats {
+		supported = append(supported, dev.Formats[i].FourCC)
+		if dev.Formats[i].FourCC == fourcc {
+			format = &dev.Formats[i]
+		}
+	}
+	if format == nil {
+		return want, fmt.Errorf("%s does not support %s (supported: %s)", dev.Path, fourcc, strings.Join(supported, ", "))
+	}
+	if len(format.Sizes) == 0 {
+		return want, nil
+	}
+
+	size := closestSize(format.Sizes, width, height)
+	mode := CaptureMode{FourCC: fourcc, Width: size.Width, Height: size.Height}
+	if size.Stepwise {
+		mode.Width = clampStep(width, size.MinWidth, size.Width, size.StepW)
+		mode.Height = clampStep(height, size.MinHeight, size.Height, size.StepH)
+	}
+	if mode.Width != width || mode.Height != height {
+		log.Printf("Resolution %dx%d is not supported by %s, using %dx%d", width, height, dev.Path, mode.Width, mode.Height)
+	}
+
+	mode.Framerate = closestFramerate(size.Framerates, framerate)
+	if framerate != "" && mode.Framerate != "" && !sameFramerate(framerate, mode.Framerate) {
+		log.Printf("Framerate %s is not supported by %s at %dx%d, using %s", framerate, dev.Path, mode.Width, mode.Height, mode.Framerate)
+	}
+	return mode, nil
+}
+
+func closestSize(sizes []VideoSize, width, height int) VideoSize {
+	best := sizes[0]
+	bestDiff := -1
+	for _, s := range sizes {
+		if s.Stepwise && width >= s.MinWidth && width <= s.Width && height >= s.MinHeight && height <= s.Height {
+			return s
+		}
+		if s.Width == width && s.Height == height {
+			return s
+		}
+		diff := abs(s.Width*s.Height - width*height)
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = s, diff
+		}
+	}
+	return best
+}
+
+// closestFramerate: rates отсортированы по убыванию; пустой запрос - максимальная частота.
+func closestFramerate(rates []string, want string) string {
+	if len(rates) == 0 {
+		return want
+	}
+	if want == "" {
+		return rates[0]
+	}
+	wn, wd, err := ParseFramerate(want)
+	if err != nil {
+		return rates[0]
+	}
+	for _, r := range rates {
+		n, d, err := ParseFramerate(r)
+		if err == nil && n*wd <= wn*d {
+			return r
+		}
+	}
+	return rates[len(rates)-1]
+}
+
+func sameFramerate(a, b string) bool {
+	an, ad, err1 := ParseFramerate(a)
+	bn, bd, err2 := ParseFramerate(b)
+	return err1 == nil && err2 == nil && an*bd == bn*ad
+}
+
+func clampStep(v, min, max, step int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	if step > 1 {
+		v = min + (v-min)/step*step
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// modeCaps дописывает к caps размер и частоту режима.
+func modeCaps(media string, mode CaptureMode) string {
+	caps := fmt.Sprintf("%s,width=%d,height=%d", media, mode.Width, mode.Height)
+	if mode.Framerate != "" {
+		caps += ",framerate=" + mode.Framerate
+	}
+	return caps
+}
+
+// ParseResolution разбирает строку вида "1920x1080".
+func ParseResolution(s string) (int, int, error) {
+	parts := strings.SplitN(strings.ToLower(s), "x", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected WIDTHxHEIGHT, got %q", s)
+	}
+	w, err := strconv.Atoi(parts[0])
+	if err != nil || w <= 0 {
+		return 0, 0, fmt.Errorf("invalid width in %q", s)
+	}
+	h, err := strconv.Atoi(parts[1])
+	if err != nil || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid height in %q", s)
+	}
+	return w, h, nil
+}
+
+// ParseFramerate разбирает частоту кадров в виде "30" или "30000/1001".
+func ParseFramerate(s string) (int, int, error) {
+	num, den := s, "1"
+	if i := strings.Index(s, "/"); i >= 0 {
+		num, den = s[:i], s[i+1:]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid framerate %q", s)
+	}
+	d, err := strconv.Atoi(den)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("invalid framerate %q", s)
+	}
+	return n, d, nil
+}
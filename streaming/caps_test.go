@@ -0,0 +1,93 @@
+package streaming
+
+import "testing"
+
+func TestParseResolution(t *testing.T) {
+	tests := []struct {
+		in      string
+		w, h    int
+		wantErr bool
+	}{
+		{"1920x1080", 1920, 1080, false},
+		{"1280X720", 1280, 720, false},
+		{"1920", 0, 0, true},
+		{"0x1080", 0, 0, true},
+		{"1920x-1", 0, 0, true},
+		{"axb", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		w, h, err := ParseResolution(tt.in)
+		if (err != nil) != tt.wantErr || w != tt.w || h != tt.h {
+			t.Errorf("ParseResolution(%q) = %d, %d, %v; want %d, %d, err=%v", tt.in, w, h, err, tt.w, tt.h, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFramerate(t *testing.T) {
+	tests := []struct {
+		in       string
+		num, den int
+		wantErr  bool
+	}{
+		{"30", 30, 1, false},
+		{"30/1", 30, 1, false},
+		{"30000/1001", 30000, 1001, false},
+		{"0", 0, 0, true},
+		{"30/0", 0, 0, true},
+		{"30/", 0, 0, true},
+		{"fast", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		num, den, err := ParseFramerate(tt.in)
+		if (err != nil) != tt.wantErr || num != tt.num || den != tt.den {
+			t.Errorf("ParseFramerate(%q) = %d, %d, %v; want %d, %d, err=%v", tt.in, num, den, err, tt.num, tt.den, tt.wantErr)
+		}
+	}
+}
+
+func TestNegotiateMode(t *testing.T) {
+	dev := &VideoDevice{
+		Path: "/dev/video0",
+		Formats: []VideoFormat{
+			{FourCC: "MJPG", Sizes: []VideoSize{
+				{Width: 1920, Height: 1080, Framerates: []string{"30/1", "15/1"}},
+				{Width: 1280, Height: 720, Framerates: []string{"60/1", "30/1"}},
+				{Width: 640, Height: 480, Framerates: []string{"30/1"}},
+			}},
+			{FourCC: "YUYV", Sizes: []VideoSize{
+				{Stepwise: true, MinWidth: 160, MinHeight: 120, Width: 1280, Height: 960, StepW: 16, StepH: 8},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		dev       *VideoDevice
+		fourcc    string
+		w, h      int
+		framerate string
+		want      CaptureMode
+		wantErr   bool
+	}{
+		{"no device info", nil, "MJPG", 1920, 1080, "30", CaptureMode{"MJPG", 1920, 1080, "30"}, false},
+		{"exact match", dev, "MJPG", 1280, 720, "60/1", CaptureMode{"MJPG", 1280, 720, "60/1"}, false},
+		{"closest size by area", dev, "MJPG", 1600, 900, "30/1", CaptureMode{"MJPG", 1280, 720, "30/1"}, false},
+		{"lower framerate", dev, "MJPG", 1920, 1080, "25", CaptureMode{"MJPG", 1920, 1080, "15/1"}, false},
+		{"empty framerate takes max", dev, "MJPG", 1280, 720, "", CaptureMode{"MJPG", 1280, 720, "60/1"}, false},
+		{"below all framerates", dev, "MJPG", 640, 480, "10/1", CaptureMode{"MJPG", 640, 480, "30/1"}, false},
+		{"stepwise snapped", dev, "YUYV", 1000, 701, "", CaptureMode{"YUYV", 992, 696, ""}, false},
+		{"stepwise clamped", dev, "YUYV", 1920, 1080, "30", CaptureMode{"YUYV", 1280, 960, "30"}, false},
+		{"unsupported format", dev, "H264", 1920, 1080, "30", CaptureMode{"H264", 1920, 1080, "30"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NegotiateMode(tt.dev, tt.fourcc, tt.w, tt.h, tt.framerate)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("NegotiateMode() = %+v, %v; want %+v, err=%v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DecoderAuto = "auto"
+
+// Decoder - цепочка декодирования MJPEG, подставляется в шаблон как {{.Decoder}}.
+type Decoder struct {
+	Name    string
+	Element string // элемент, по которому проверяется наличие (gst-inspect-1.0)
+	Chain   string
+}
+
+// decoders в порядке предпочтения: аппаратные первыми, программный - последним.
+var decoders = []Decoder{
+	{Name: "vaapi", Element: "vaapijpegdec", Chain: "jpegparse ! vaapijpegdec"},
+	{Name: "v4l2", Element: "v4l2jpegdec", Chain: "jpegparse ! v4l2jpegdec ! videoconvert"},
+	{Name: "software", Element: "jpegdec", Chain: "jpegparse ! jpegdec ! videoconvert"},
+}
+
+// DecoderNames - допустимые значения stream.decoder.
+func DecoderNames() []string {
+	names := []string{DecoderAuto}
+	for _, d := range decoders {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func findDecoder(name string) (Decoder, bool) {
+	for _, d := range decoders {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Decoder{}, false
+}
+
+// ValidateDecoder проверяет значение stream.decoder.
+func ValidateDecoder(name string) error {
+	if name == "" || name == DecoderAuto {
+		return nil
+	}
+	if _, ok := findDecoder(name); !ok {
+		return fmt.Errorf("unknown decoder %q (available: %v)", name, DecoderNames())
+	}
+	return nil
+}
+
+// elementExists спрашивает gst-inspect-1.0, установлен ли элемент.
+func elementExists(element string) bool {
+	return exec.Command("gst-inspect-1.0", element).Run() == nil
+}
+
+// ProbeDecoders возвращает декодеры, элементы которых есть в системе.
+func ProbeDecoders() []Decoder {
+	var available []Decoder
+	for _, d := range decoders {
+		if elementExists(d.Element) {
+			available = append(available, d)
+		}
+	}
+	return available
+}
+
+var (
+	probeOnce sync.Once
+	probed    []Decoder
+)
+
+// availableDecoders проверяет элементы один раз при старте агента: набор
+// плагинов GStreamer без перезапуска не меняется.
+func availableDecoders() []Decoder {
+	probeOnce.Do(func() {
+		probed = ProbeDecoders()
+		log.Printf("Available decoders: %v", decoderNames(probed))
+	})
+	return probed
+}
+
+func decoderNames(list []Decoder) []string {
+	names := make([]string, len(list))
+	for i, d := range list {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// selectDecoder выбирает цепочку для очередного запуска: явно заданную в конфиге
+// или, в режиме auto, первую доступную и еще не отвергнутую, начиная с запомненной.
+// Вызывается под mu.
+func (s *Streamer) selectDecoder() (Decoder, error) {
+	if name := s.config.Decoder; name != "" && name != DecoderAuto {
+		d, ok := findDecoder(name)
+		if !ok {
+			return Decoder{}, fmt.Errorf("unknown decoder %q", name)
+		}
+		return d, nil
+	}
+	if len(s.available) == 0 {
+		return Decoder{}, fmt.Errorf("no JPEG decoder found (tried %v)", decoderElements())
+	}
+
+	candidates := s.decoderCandidates()
+	for _, d := range candidates {
+		if !s.rejected[d.Name] {
+			return d, nil
+		}
+	}
+	// все отвергнуты - скорее всего, дело не в декодере; начинаем сначала
+	s.rejected = nil
+	return candidates[0], nil
+}
+
+// usesDecoder - выбирается ли декодер вообще: только для gstreamer-шаблонов с {{.Decoder}}.
+func (s *Streamer) usesDecoder() bool {
+	backend := s.config.Backend
+	return (backend == "" || backend == BackendGStreamer) && TemplateUsesDecoder(s.config)
+}
+
+// plannedDecoder - имя декодера, который выберет следующий запуск; для статуса,
+// пока пайплайн не запущен. Вызывается под mu.
+func (s *Streamer) plannedDecoder() string {
+	if name := s.config.Decoder; name != "" && name != DecoderAuto {
+		return name
+	}
+	candidates := s.decoderCandidates()
+	for _, d := range candidates {
+		if !s.rejected[d.Name] {
+			return d.Name
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0].Name
+	}
+	return ""
+}
+
+// decoderCandidates - доступные декодеры, запомненный рабочий первым. Вызывается под mu.
+func (s *Streamer) decoderCandidates() []Decoder {
+	if remembered := s.loadDecoder(); remembered != "" {
+		return preferDecoder(s.available, remembered)
+	}
+	return s.available
+}
+
+// rejectDecoder отмечает декодер как неработающий, если пайплайн упал быстро
+// и в выводе упоминается его элемент. Вызывается под mu.
+func (s *Streamer) rejectDecoder(uptime time.Duration, stderr string) bool {
+	if s.decoder.Name == "" || (s.config.Decoder != "" && s.config.Decoder != DecoderAuto) {
+		return false
+	}
+	if uptime >= decoderStableTime(s.config.Restart.StableSec) || !strings.Contains(stderr, s.decoder.Element) {
+		return false
+	}
+	if s.rejected == nil {
+		s.rejected = make(map[string]bool)
+	}
+	s.rejected[s.decoder.Name] = true
+	log.Printf("Decoder %s failed, falling back to the next one", s.decoder.Name)
+	return true
+}
+
+// decoderStable вызывается, когда пайплайн проработал достаточно долго:
+// выбранный декодер запоминается для следующих запусков.
+func (s *Streamer) decoderStable(d Decoder) {
+	if d.Name == "" || s.DecoderStatePath == "" || s.loadDecoder() == d.Name {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.DecoderStatePath), 0700); err != nil {
+		log.Printf("Failed to save decoder choice: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.DecoderStatePath, []byte(d.Name+"\n"), 0600); err != nil {
+		log.Printf("Failed to save decoder choice: %v", err)
+		return
+	}
+	log.Printf("Decoder %s remembered as working", d.Name)
+}
+
+func (s *Streamer) loadDecoder() string {
+	if s.DecoderStatePath == "" {
+		return ""
+	}
+	data, err := os.ReadFile(s.DecoderStatePath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func preferDecoder(list []Decoder, name string) []Decoder {
+	ordered := make([]Decoder, 0, len(list))
+	for _, d := range list {
+		if d.Name == name {
+			ordered = append(ordered, d)
+		}
+	}
+	for _, d := range list {
+		if d.Name != name {
+			ordered = append(ordered, d)
+		}
+	}
+	return ordered
+}
+
+func decoderElements() []string {
+	elements := make([]string, len(decoders))
+	for i, d := range decoders {
+		elements[i] = d.Element
+	}
+	return elements
+}
+
+// decoderStableTime - сколько должен проработать пайплайн, чтобы декодер считался рабочим.
+func decoderStableTime(stableSec int) time.Duration {
+	if stableSec <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(stableSec) * time.Second
+}
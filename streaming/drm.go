@@ -0,0 +1,202 @@
+package streaming
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"rentiga-device/models"
+)
+
+// ioctl-коды из drm/drm.h и drm/drm_mode.h
+const (
+	drmIoctlModeGetResources = 0xc04064a0
+	drmIoctlModeGetConnector = 0xc05064a7
+)
+
+type drmModeCardRes struct {
+	FbIDPtr         uint64
+	CrtcIDPtr       uint64
+	ConnectorIDPtr  uint64
+	EncoderIDPtr    uint64
+	CountFbs        uint32
+	CountCrtcs      uint32
+	CountConnectors uint32
+	CountEncoders   uint32
+	MinWidth        uint32
+	MaxWidth        uint32
+	MinHeight       uint32
+	MaxHeight       uint32
+}
+
+type drmModeGetConnector struct {
+	EncodersPtr     uint64
+	ModesPtr        uint64
+	PropsPtr        uint64
+	PropValuesPtr   uint64
+	CountModes      uint32
+	CountProps      uint32
+	CountEncoders   uint32
+	EncoderID       uint32
+	ConnectorID     uint32
+	ConnectorType   uint32
+	ConnectorTypeID uint32
+	Connection      uint32
+	MmWidth         uint32
+	MmHeight        uint32
+	Subpixel        uint32
+	Pad             uint32
+}
+
+// имена типов коннекторов так же, как их пишет ядро в /sys/class/drm
+var drmConnectorTypes = []string{
+	"Unknown", "VGA", "DVI-I", "DVI-D", "DVI-A", "Composite", "SVIDEO", "LVDS",
+	"Component", "DIN", "DP", "HDMI-A", "HDMI-B", "TV", "eDP", "Virtual", "DSI",
+	"DPI", "Writeback", "SPI", "USB",
+}
+
+// DisplayConnector - выход DRM/KMS, на который kmssink выводит изображение.
+type DisplayConnector struct {
+	ID      uint32   `json:"id"`
+	Name    string   `json:"name"` // HDMI-A-1, DP-1
+	Card    string   `json:"card"`
+	Status  string   `json:"status"` // connected, disconnected, unknown
+	Enabled bool     `json:"enabled"`
+	Modes   []string `json:"modes"`
+}
+
+// ListConnectors перечисляет коннекторы всех карт из /sys/class/drm.
+// Старые ядра не публикуют connector_id в sysfs - тогда ID берется из ioctl карты.
+func ListConnectors() ([]DisplayConnector, error) {
+	dirs, err := filepath.Glob("/sys/class/drm/card*-*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+
+	ids := make(map[string]map[string]uint32) // карта -> имя -> id
+	connectors := []DisplayConnector{}
+	for _, dir := range dirs {
+		card, name, ok := strings.Cut(filepath.Base(dir), "-")
+		if !ok {
+			continue
+		}
+		c := DisplayConnector{
+			Name:    name,
+			Card:    card,
+			Status:  readSysfs(dir, "status"),
+			Enabled: readSysfs(dir, "enabled") == "enabled",
+			Modes:   uniqueLines(readSysfs(dir, "modes")),
+		}
+
+		if v := readSysfs(dir, "connector_id"); v != "" {
+			if id, err := strconv.ParseUint(v, 10, 32); err == nil {
+				c.ID = uint32(id)
+			}
+		}
+		if c.ID == 0 {
+			if _, ok := ids[card]; !ok {
+				ids[card], _ = drmConnectorIDs("/dev/dri/" + card)
+			}
+			c.ID = ids[card][name]
+		}
+		connectors = append(connectors, c)
+	}
+	return connectors, nil
+}
+
+// ResolveConnector возвращает числовой connector-id для kmssink: имя коннектора
+// (stream.connector) ищется среди текущих, иначе используется stream.connector_id.
+func ResolveConnector(cfg *models.StreamConfig) (string, error) {
+	if cfg.Connector == "" {
+		return cfg.ConnectorID, nil
+	}
+	connectors, err := ListConnectors()
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(connectors))
+	for _, c := range connectors {
+		if strings.EqualFold(c.Name, cfg.Connector) {
+			if c.ID == 0 {
+				return "", fmt.Errorf("connector %s found but its ID is unknown", c.Name)
+			}
+			return strconv.FormatUint(uint64(c.ID), 10), nil
+		}
+		names = append(names, c.Name)
+	}
+	return "", fmt.Errorf("connector %q not found (available: %s)", cfg.Connector, strings.Join(names, ", "))
+}
+
+// drmConnectorIDs сопоставляет имена коннекторов их ID через ioctl карты.
+// Права DRM master для этого не нужны.
+func drmConnectorIDs(cardPath string) (map[string]uint32, error) {
+	fd, err := syscall.Open(cardPath, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	// первый вызов узнает количество, второй заполняет массив
+	var res drmModeCardRes
+	if err := ioctl(fd, drmIoctlModeGetResources, unsafe.Pointer(&res)); err != nil {
+		return nil, err
+	}
+	if res.CountConnectors == 0 {
+		return map[string]uint32{}, nil
+	}
+	connIDs := make([]uint32, res.CountConnectors)
+	res = drmModeCardRes{
+		ConnectorIDPtr:  uint64(uintptr(unsafe.Pointer(&connIDs[0]))),
+		CountConnectors: uint32(len(connIDs)),
+	}
+	err = ioctl(fd, drmIoctlModeGetResources, unsafe.Pointer(&res))
+	runtime.KeepAlive(connIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]uint32, len(connIDs))
+	for _, id := range connIDs[:min(len(connIDs), int(res.CountConnectors))] {
+		conn := drmModeGetConnector{ConnectorID: id}
+		if err := ioctl(fd, drmIoctlModeGetConnector, unsafe.Pointer(&conn)); err != nil {
+			continue
+		}
+		typeName := "Unknown"
+		if int(conn.ConnectorType) < len(drmConnectorTypes) {
+			typeName = drmConnectorTypes[conn.ConnectorType]
+		}
+		result[fmt.Sprintf("%s-%d", typeName, conn.ConnectorTypeID)] = id
+	}
+	return result, nil
+}
+
+func readSysfs(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// uniqueLines - список режимов из sysfs без повторов (режимы с разной частотой
+// называются одинаково).
+func uniqueLines(s string) []string {
+	lines := []string{}
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		lines = append(lines, line)
+	}
+	return lines
+}
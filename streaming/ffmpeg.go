@@ -1,65 +1,75 @@
 package streaming
 
 import (
-	// "bytes"
 	"fmt"
-	"log"
-
-	// "os"
-	"os/exec"
-	"strings"
-	"syscall"
 
 	"rentiga-device/models"
 )
 
-type Streamer struct {
-    config   *models.StreamConfig
-    deviceID string
-    cmd      *exec.Cmd
-}
-
-func NewStreamer(cfg *models.StreamConfig, deviceId string) *Streamer {
-    return &Streamer{config: cfg, deviceID: deviceId}
-}
+// ffmpegPipeline - альтернативный бэкенд на ffmpeg для систем без GStreamer/VA-API.
+// Вывод идет в framebuffer (StreamConfig.FFmpegOutput, по умолчанию /dev/fb0)
+// или в окно SDL, если указано "sdl".
+type ffmpegPipeline struct{}
 
-func (s *Streamer) Start() error {
-    if s.cmd != nil {
-        return fmt.Errorf("stream already running")
-    }
+func (ffmpegPipeline) Name() string { return BackendFFmpeg }
 
-    args := []string{
-        "-v",
-        "v4l2src", fmt.Sprintf("device=%s", s.config.Device),
-        "!", "image/jpeg",
-        "!", "jpegparse",
-        "!", "vaapijpegdec",
-        "!", "queue", "max-size-buffers=3", "leaky=downstream",
-        "!", "kmssink",
-        fmt.Sprintf("connector-id=%s", s.config.ConnectorID),
-        "sync=false",
-        "force-modesetting=true",
-        "show-preroll-frame=false",
-    }
+func (ffmpegPipeline) StreamCommand(p PipelineParams) (string, []string, error) {
+	cfg := p.Config
+	mode, err := p.negotiate("MJPG")
+	if err != nil {
+		return "", nil, err
+	}
 
-    s.cmd = exec.Command("gst-launch-1.0", args...)
+	args := []string{
+		"-hide_banner", "-loglevel", "warning",
+		// счетчики кадров для статистики пайплайна (см. stats.go)
+		"-progress", "pipe:1", "-nostats",
+		"-f", "v4l2",
+		"-input_format", "mjpeg",
+		"-video_size", fmt.Sprintf("%dx%d", mode.Width, mode.Height),
+	}
+	if mode.Framerate != "" {
+		args = append(args, "-framerate", mode.Framerate)
+	}
+	args = append(args, "-i", p.Device)
 
-    var stderr strings.Builder
-    s.cmd.Stderr = &stderr
+	transform := ffmpegTransform(cfg.Transform)
+	if p.OverlayPath != "" {
+		// плашка накладывается после преобразования кадра, как и в GStreamer
+		video := "[0:v]"
+		if transform != "" {
+			video = "[0:v]" + transform + "[v];[v]"
+		}
+		// image2 с -loop 1 перечитывает файл на каждом кадре, как multifilesrc в GStreamer
+		args = append(args,
+			"-framerate", "1", "-loop", "1", "-i", p.OverlayPath,
+			"-filter_complex", video+"[1:v]overlay=0:0:shortest=0:eof_action=repeat[out]",
+			"-map", "[out]",
+		)
+	} else if transform != "" {
+		args = append(args, "-vf", transform)
+	}
 
-    if err := s.cmd.Start(); err != nil {
-        log.Printf("GStreamer command: %s", strings.Join(s.cmd.Args, " "))
-        log.Printf("GStreamer error: %v\n%s", err, stderr.String())
-        return fmt.Errorf("failed to start stream: %v", err)
-    }
+	args = append(args, ffmpegOutput(cfg)...)
+	return "ffmpeg", args, nil
+}
 
-    return nil
+func (ffmpegPipeline) ImageCommand(cfg *models.StreamConfig, imagePath string) (string, []string, error) {
+	args := []string{
+		"-hide_banner", "-loglevel", "warning",
+		"-re", "-framerate", "1", "-loop", "1", "-i", imagePath,
+	}
+	args = append(args, ffmpegOutput(cfg)...)
+	return "ffmpeg", args, nil
 }
 
-func (s *Streamer) Stop() {
-    if s.cmd != nil {
-        s.cmd.Process.Signal(syscall.SIGINT)
-        s.cmd.Wait()
-        s.cmd = nil
-    }
-}
\ No newline at end of file
+func ffmpegOutput(cfg *models.StreamConfig) []string {
+	switch cfg.FFmpegOutput {
+	case "sdl":
+		return []string{"-pix_fmt", "yuv420p", "-f", "sdl", "Rentiga"}
+	case "":
+		return []string{"-pix_fmt", "bgra", "-f", "fbdev", "/dev/fb0"}
+	default:
+		return []string{"-pix_fmt", "bgra", "-f", "fbdev", cfg.FFmpegOutput}
+	}
+}
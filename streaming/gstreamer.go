@@ -0,0 +1,108 @@
+package streaming
+
+import (
+	"fmt"
+	"strings"
+
+	"rentiga-device/models"
+)
+
+// gstreamerPipeline - основной бэкенд: описание пайплайна берется из шаблона,
+// по умолчанию v4l2src (MJPEG) -> VA-API -> kmssink.
+type gstreamerPipeline struct{}
+
+func (gstreamerPipeline) Name() string { return BackendGStreamer }
+
+// StreamCommand рендерит шаблон stream.template (см. template.go).
+func (gstreamerPipeline) StreamCommand(p PipelineParams) (string, []string, error) {
+	cfg := p.Config
+	connector, err := ResolveConnector(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	vars := TemplateVars{
+		Device:        p.Device,
+		Connector:     connector,
+		Resolution:    cfg.Resolution,
+		Width:         p.Width,
+		Height:        p.Height,
+		Framerate:     cfg.Framerate,
+		Caps:          cfg.Caps,
+		Decoder:       p.Decoder,
+		Transform:     strings.Join(gstTransform(cfg.Transform), " "),
+		Overlay:       strings.Join(gstOverlayMixer(p.OverlayPath), " "),
+		OverlaySource: strings.Join(gstOverlaySource(p.OverlayPath), " "),
+		Vars:          cfg.Variables,
+	}
+	vars.negotiate = func(media string) (string, error) {
+		fourcc, ok := gstFormats[media]
+		if !ok {
+			// формат неизвестен V4L2-таблице - ставим размер из конфига без проверки
+			return modeCaps(media, CaptureMode{Width: p.Width, Height: p.Height, Framerate: cfg.Framerate}), nil
+		}
+		mode, err := p.negotiate(fourcc)
+		if err != nil {
+			return "", err
+		}
+		return modeCaps(media, mode), nil
+	}
+	if p.Tap != nil && TemplateUsesTap(cfg) {
+		vars.Tap = tapTee(p.Tap.SocketPath)
+		vars.TapBranch = tapBranch(p.Tap.SocketPath)
+		p.Tap.Active = true
+	}
+	if vars.Decoder == "" {
+		vars.Decoder = decoders[0].Chain
+	}
+	args, err := RenderTemplate(cfg, vars)
+	if err != nil {
+		return "", nil, err
+	}
+	return "gst-launch-1.0", append([]string{"-v"}, args...), nil
+}
+
+func (gstreamerPipeline) ImageCommand(cfg *models.StreamConfig, imagePath string) (string, []string, error) {
+	connector, err := ResolveConnector(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	args := gstImageSource(imagePath)
+	args = append(args,
+		"!", "kmssink",
+		fmt.Sprintf("connector-id=%s", connector),
+		"sync=false",
+		"force-modesetting=true",
+	)
+	return "gst-launch-1.0", args, nil
+}
+
+// gstOverlayMixer - плашка накладывается через compositor, второй вход которого
+// добавляет gstOverlaySource.
+func gstOverlayMixer(overlayPath string) []string {
+	if overlayPath == "" {
+		return nil
+	}
+	return []string{
+		"!", "videoconvert",
+		"!", "compositor", "name=mix", "sink_1::zorder=1",
+		"!", "videoconvert",
+	}
+}
+
+func gstOverlaySource(overlayPath string) []string {
+	if overlayPath == "" {
+		return nil
+	}
+	return append(gstImageSource(overlayPath), "!", "mix.")
+}
+
+// gstImageSource читает PNG раз в секунду: multifilesrc с loop=true открывает файл
+// заново для каждого буфера, поэтому подмена файла видна без перезапуска.
+func gstImageSource(path string) []string {
+	return []string{
+		"multifilesrc", fmt.Sprintf("location=%s", path), "loop=true",
+		"caps=image/png,framerate=1/1",
+		"!", "pngdec",
+		"!", "videoconvert",
+	}
+}
@@ -0,0 +1,158 @@
+package streaming
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// StateWaiting - поток запрошен, но устройства захвата нет: пайплайн запустится,
+// когда устройство с той же идентичностью появится снова.
+const StateWaiting = "waiting_for_source"
+
+const (
+	EventSourceLost     = "source_lost"
+	EventSourceRestored = "source_restored"
+)
+
+const sourcePollInterval = time.Second
+
+// sourceIdentity возвращает стабильное имя устройства: ссылку из /dev/v4l/by-id
+// (в ней есть производитель и серийный номер), иначе из /dev/v4l/by-path (порт USB)
+// и только потом сам путь. После переподключения донгл может получить другой
+// /dev/videoN, но эти ссылки останутся прежними.
+func sourceIdentity(device string) string {
+	if strings.HasPrefix(device, "/dev/v4l/") {
+		return device
+	}
+	if target, err := filepath.EvalSymlinks(device); err == nil {
+		if id, ok := videoByID()[target]; ok {
+			return id
+		}
+		if id, ok := videoByPath()[target]; ok {
+			return id
+		}
+	}
+	return device
+}
+
+// resolveSource находит текущий узел устройства по идентичности.
+func resolveSource(identity string) (string, bool) {
+	path, err := filepath.EvalSymlinks(identity)
+	if err != nil {
+		return "", false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// watchesSource - тестовому бэкенду устройство не нужно.
+func (s *Streamer) watchesSource() bool {
+	return s.config.Backend != BackendTest
+}
+
+// startSourceWatch запускает опрос устройства. Вызывается под mu.
+func (s *Streamer) startSourceWatch() {
+	if !s.watchesSource() || s.watchStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	s.watchStop = stop
+	go s.watchSource(stop)
+}
+
+// stopSourceWatch вызывается под mu.
+func (s *Streamer) stopSourceWatch() {
+	if s.watchStop != nil {
+		close(s.watchStop)
+		s.watchStop = nil
+	}
+}
+
+func (s *Streamer) watchSource(stop chan struct{}) {
+	ticker := time.NewTicker(sourcePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.checkSource()
+		}
+	}
+}
+
+// checkSource останавливает пайплайн, если устройство пропало, и запускает его,
+// когда устройство вернулось.
+func (s *Streamer) checkSource() {
+	s.mu.Lock()
+	if !s.wanted {
+		s.mu.Unlock()
+		return
+	}
+
+	path, present := resolveSource(s.identity)
+
+	if !present && s.cmd != nil && !s.sourceLost {
+		// процесс сам упадет с ошибкой чтения; wait по флагу поймет, что это не сбой
+		log.Printf("Capture device %s removed, stopping pipeline", s.identity)
+		s.sourceLost = true
+		s.cmd.Process.Signal(syscall.SIGINT)
+		s.mu.Unlock()
+		return
+	}
+
+	if !present || s.state != StateWaiting {
+		s.mu.Unlock()
+		return
+	}
+	// узел появляется раньше, чем драйвер готов отвечать на запросы
+	if _, err := ProbeVideoDevice(path); err != nil {
+		s.mu.Unlock()
+		return
+	}
+
+	s.source = path
+	s.sourceLost = false
+	s.state = StateRestarting
+	s.mu.Unlock()
+
+	// до запуска: приложение убирает заставку с коннектора, который займет пайплайн
+	log.Printf("Capture device %s is back as %s, resuming stream", s.identity, path)
+	s.notify(EventSourceRestored, map[string]interface{}{"device": path, "source_id": s.identity})
+
+	s.mu.Lock()
+	if !s.wanted || s.cmd != nil {
+		s.mu.Unlock()
+		return
+	}
+	if err := s.launch(); err != nil {
+		// как и при перезапуске: задержка и лимит max_restarts
+		event, data := s.handleCrash(err, "")
+		s.mu.Unlock()
+		s.notify(EventCrashed, data)
+		if event == EventFailed {
+			s.notify(EventFailed, data)
+		}
+		return
+	}
+	s.mu.Unlock()
+}
+
+// enterWaiting переводит поток в ожидание устройства. Вызывается под mu.
+func (s *Streamer) enterWaiting() map[string]interface{} {
+	s.state = StateWaiting
+	s.sourceLost = true
+	if s.restartTimer != nil {
+		s.restartTimer.Stop()
+		s.restartTimer = nil
+	}
+	log.Printf("Waiting for capture device %s", s.identity)
+	return map[string]interface{}{"device": s.source, "source_id": s.identity}
+}
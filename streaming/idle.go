@@ -0,0 +1,311 @@
+package streaming
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+
+	"rentiga-device/models"
+
+	"golang.org/x/image/font"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/fixed"
+)
+
+// IdleScreen показывает заставку с QR-кодом аренды на том же выходе (бэкенд
+// StreamConfig.Backend), что и трансляция, пока поток не запущен. Заставка и трансляция не могут работать
+// одновременно: перед Streamer.Start заставку нужно скрыть.
+type IdleScreen struct {
+	mu       sync.Mutex
+	config   *models.StreamConfig
+	deviceID string
+	status   string
+	path     string
+	cmd      *exec.Cmd
+	done     chan struct{}
+}
+
+func NewIdleScreen(cfg models.StreamConfig) *IdleScreen {
+	return &IdleScreen{
+		config: &cfg,
+		status: cfg.Idle.StatusText,
+		path:   filepath.Join(cfg.TempDir, "idle.png"),
+	}
+}
+
+// Update заменяет конфиг заставки; показанная заставка перерисуется с ним
+// при следующем Show.
+func (i *IdleScreen) Update(cfg models.StreamConfig) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.config = &cfg
+	if i.cmd == nil {
+		// пайплайн заставки читает файл по старому пути, пока не остановлен
+		i.path = filepath.Join(cfg.TempDir, "idle.png")
+	}
+}
+
+// RentalURL подставляет DeviceID в шаблон ссылки на аренду.
+func RentalURL(tmpl, deviceID string) (string, error) {
+	t, err := template.New("url").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid rental URL template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, map[string]string{"DeviceID": deviceID}); err != nil {
+		return "", fmt.Errorf("invalid rental URL template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// SetDeviceID перерисовывает заставку для нового устройства (после загрузки сертификата).
+func (i *IdleScreen) SetDeviceID(deviceID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.deviceID = deviceID
+	if i.cmd != nil {
+		if err := i.render(); err != nil {
+			log.Printf("Idle screen render error: %v", err)
+		}
+	}
+}
+
+// SetStatus меняет строку статуса под QR-кодом. Пайплайн заставки перечитывает файл
+// раз в секунду, так что перезапуск не нужен.
+func (i *IdleScreen) SetStatus(text string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.status = text
+	if i.cmd != nil {
+		if err := i.render(); err != nil {
+			log.Printf("Idle screen render error: %v", err)
+		}
+	}
+}
+
+func (i *IdleScreen) Visible() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.cmd != nil
+}
+
+// Show рисует заставку и запускает ее пайплайн, если он еще не запущен.
+func (i *IdleScreen) Show() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.config.Idle.Enabled || i.cmd != nil {
+		return nil
+	}
+
+	if err := i.render(); err != nil {
+		return fmt.Errorf("failed to render idle screen: %v", err)
+	}
+
+	backend, err := PipelineFor(i.config.Backend)
+	if err != nil {
+		return err
+	}
+	name, args, err := backend.ImageCommand(i.config, i.path)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(name, args...)
+	stderr := &strings.Builder{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start idle screen: %v", err)
+	}
+
+	i.cmd = cmd
+	i.done = make(chan struct{})
+	go i.wait(cmd, i.done, stderr)
+	return nil
+}
+
+func (i *IdleScreen) wait(cmd *exec.Cmd, done chan struct{}, stderr *strings.Builder) {
+	err := cmd.Wait()
+
+	i.mu.Lock()
+	unexpected := i.cmd == cmd
+	if unexpected {
+		i.cmd = nil
+	}
+	i.mu.Unlock()
+	close(done)
+
+	if unexpected {
+		log.Printf("Idle screen pipeline exited: %v\n%s", err, stderr.String())
+	}
+}
+
+// Hide останавливает пайплайн заставки и освобождает коннектор.
+func (i *IdleScreen) Hide() {
+	i.mu.Lock()
+	cmd, done := i.cmd, i.done
+	i.cmd = nil
+	i.mu.Unlock()
+
+	if cmd == nil {
+		return
+	}
+	cmd.Process.Signal(syscall.SIGINT)
+	<-done
+}
+
+// render вызывается под mu.
+func (i *IdleScreen) render() error {
+	cfg := i.config.Idle
+
+	width, height, err := ParseResolution(i.config.Resolution)
+	if err != nil {
+		return err
+	}
+
+	bg := color.NRGBA{A: 255}
+	if cfg.BackgroundColor != "" {
+		if c, err := ParseColor(cfg.BackgroundColor); err == nil {
+			bg = c
+		}
+	}
+	fg := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	if cfg.TextColor != "" {
+		if c, err := ParseColor(cfg.TextColor); err == nil {
+			fg = c
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	qrSize := cfg.QRSize
+	if qrSize <= 0 {
+		qrSize = height / 2
+	}
+	qrTop := (height - qrSize) / 2
+
+	if i.deviceID != "" && cfg.URLTemplate != "" {
+		url, err := RentalURL(cfg.URLTemplate, i.deviceID)
+		if err != nil {
+			return err
+		}
+		// у дополнительных потоков QR лежит в их собственном каталоге, которого еще нет
+		if err := os.MkdirAll(filepath.Dir(i.config.QRPath), 0755); err != nil {
+			return err
+		}
+		if err := GenerateQR(url, i.config.QRPath, qrSize); err != nil {
+			return err
+		}
+		qr, err := loadImage(i.config.QRPath)
+		if err != nil {
+			return err
+		}
+		left := (width - qrSize) / 2
+		draw.Draw(img, image.Rect(left, qrTop, left+qrSize, qrTop+qrSize), qr, qr.Bounds().Min, draw.Src)
+	}
+
+	if cfg.LogoPath != "" {
+		logo, err := loadImage(cfg.LogoPath)
+		if err != nil {
+			// без логотипа заставка все равно полезна
+			log.Printf("Idle screen logo error: %v", err)
+		} else {
+			drawLogo(img, logo, qrTop)
+		}
+	}
+
+	textSize := height / 24
+	face, err := loadFace(i.config.FontPath, textSize)
+	if err != nil {
+		return err
+	}
+
+	y := qrTop + qrSize + textSize*2
+	if i.status != "" {
+		drawCentered(img, face, fg, i.status, y)
+		y += textSize * 3 / 2
+	}
+	if i.deviceID != "" {
+		drawCentered(img, face, fg, "ID: "+i.deviceID, y)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(i.path), 0755); err != nil {
+		return err
+	}
+	tmp := i.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, i.path)
+}
+
+// drawLogo вписывает логотип в полосу над QR-кодом с сохранением пропорций.
+func drawLogo(img *image.NRGBA, logo image.Image, qrTop int) {
+	width := img.Bounds().Dx()
+	maxH := qrTop * 2 / 3
+	maxW := width / 2
+	lb := logo.Bounds()
+	if maxH <= 0 || lb.Dx() == 0 || lb.Dy() == 0 {
+		return
+	}
+
+	w, h := lb.Dx(), lb.Dy()
+	if w > maxW {
+		h = h * maxW / w
+		w = maxW
+	}
+	if h > maxH {
+		w = w * maxH / h
+		h = maxH
+	}
+
+	left := (width - w) / 2
+	top := (qrTop - h) / 2
+	xdraw.CatmullRom.Scale(img, image.Rect(left, top, left+w, top+h), logo, lb, draw.Over, nil)
+}
+
+func drawCentered(img *image.NRGBA, face font.Face, c color.Color, text string, baseline int) {
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face}
+	w := d.MeasureString(text).Ceil()
+	d.Dot = fixed.P((img.Bounds().Dx()-w)/2, baseline)
+	d.DrawString(text)
+}
+
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	return img, nil
+}
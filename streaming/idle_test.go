@@ -0,0 +1,34 @@
+package streaming
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rentiga-device/models"
+)
+
+func TestIdleRenderCreatesDirs(t *testing.T) {
+	// как у дополнительного потока: temp_dir/<name>, QR внутри него
+	dir := filepath.Join(t.TempDir(), "rentiga", "cam2")
+	cfg := models.StreamConfig{
+		Resolution: "640x360",
+		TempDir:    dir,
+		QRPath:     filepath.Join(dir, "qr.png"),
+		Idle: models.IdleConfig{
+			Enabled:     true,
+			URLTemplate: "https://example.com/rent/{{.DeviceID}}",
+		},
+	}
+
+	i := NewIdleScreen(cfg)
+	i.deviceID = "device-1"
+	if err := i.render(); err != nil {
+		t.Fatalf("render() error: %v", err)
+	}
+	for _, path := range []string{cfg.QRPath, filepath.Join(dir, "idle.png")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s not written: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"rentiga-device/models"
+)
+
+// NetworkRTSP не поднимает RTSP-сервер на устройстве: rtspclientsink публикует
+// поток на внешний сервер (mediamtx и т.п.) по rtsp_url, зрители подключаются к нему.
+// Без внешнего сервера нужен NetworkHLS - его отдает веб-сервер агента.
+const (
+	NetworkHLS  = "hls"
+	NetworkRTSP = "rtsp"
+)
+
+const (
+	NetworkStopped = "stopped"
+	NetworkWaiting = "waiting" // вывод включен, но отвода кадров нет
+	NetworkActive  = "streaming"
+)
+
+// HLSPlaylist - имя плейлиста в каталоге stream.network.dir.
+const HLSPlaylist = "index.m3u8"
+
+const (
+	hlsSegmentPrefix   = "segment"
+	networkStopTimeout = 5 * time.Second
+)
+
+// NetworkOutput отдает трансляцию в сеть отдельным процессом, читающим отвод
+// пайплайна: сегменты HLS для веб-сервера или публикация на внешний RTSP-сервер.
+// Локальный вывод на экран при этом не меняется; после перезапуска пайплайна
+// процесс поднимается сам, как и запись.
+type NetworkOutput struct {
+	mu         sync.Mutex
+	config     models.NetworkConfig
+	tap        func() (TapInfo, bool)
+	running    bool
+	protocol   string // протокол на момент запуска: config может смениться при перезагрузке
+	dir        string
+	cmd        *exec.Cmd
+	done       chan struct{}
+	loopStop   chan struct{}
+	failures   int
+	launchedAt time.Time
+	retryAt    time.Time
+	lastError  string
+	encoder    string
+}
+
+func NewNetworkOutput(cfg models.NetworkConfig, tap func() (TapInfo, bool)) *NetworkOutput {
+	return &NetworkOutput{config: cfg, tap: tap}
+}
+
+// Update меняет настройки; идущий вывод подхватит их после Stop и Start.
+func (n *NetworkOutput) Update(cfg models.NetworkConfig) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.config = cfg
+}
+
+func (n *NetworkOutput) Start() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.running {
+		return nil
+	}
+	n.protocol = n.config.Protocol
+	n.dir = n.config.Dir
+	if n.protocol == NetworkHLS {
+		if err := os.MkdirAll(n.dir, 0755); err != nil {
+			return fmt.Errorf("failed to create HLS dir: %v", err)
+		}
+		// сегменты прошлого запуска не должны попасть в новый плейлист
+		n.removeSegments()
+	}
+
+	n.running = true
+	n.encoder = resolveEncoder(n.config.Encoder)
+	n.failures = 0
+	n.retryAt = time.Time{}
+	n.lastError = ""
+	n.loopStop = make(chan struct{})
+	go n.loop(n.loopStop)
+	log.Printf("Network output (%s) enabled", n.protocol)
+	return nil
+}
+
+func (n *NetworkOutput) Stop() {
+	n.mu.Lock()
+	if !n.running {
+		n.mu.Unlock()
+		return
+	}
+	n.running = false
+	close(n.loopStop)
+	cmd, done := n.cmd, n.done
+	n.mu.Unlock()
+
+	if cmd != nil {
+		stopProcess(cmd, done, networkStopTimeout)
+	}
+	log.Println("Network output disabled")
+}
+
+func (n *NetworkOutput) loop(stop chan struct{}) {
+	ticker := time.NewTicker(recorderPoll)
+	defer ticker.Stop()
+
+	n.tick()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n.tick()
+		}
+	}
+}
+
+func (n *NetworkOutput) tick() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if !n.running || n.cmd != nil || time.Now().Before(n.retryAt) {
+		return
+	}
+	tap, ok := n.tap()
+	if !ok {
+		return
+	}
+
+	cmd := exec.Command("gst-launch-1.0", n.pipelineArgs(tap)...)
+	stderr := newTailBuffer(stderrTailLimit)
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		n.failed(fmt.Sprintf("failed to start network output: %v", err))
+		return
+	}
+
+	n.cmd = cmd
+	n.done = make(chan struct{})
+	n.launchedAt = time.Now()
+	go n.wait(cmd, n.done, stderr)
+}
+
+func (n *NetworkOutput) wait(cmd *exec.Cmd, done chan struct{}, stderr *tailBuffer) {
+	err := cmd.Wait()
+
+	n.mu.Lock()
+	if n.cmd == cmd {
+		n.cmd = nil
+	}
+	if n.running {
+		if time.Since(n.launchedAt) >= time.Minute {
+			n.failures = 0
+		}
+		n.failed(describeExit(err, stderr.String()))
+	}
+	n.mu.Unlock()
+	close(done)
+}
+
+// failed вызывается под mu.
+func (n *NetworkOutput) failed(msg string) {
+	n.failures++
+	n.lastError = msg
+	n.retryAt = time.Now().Add(restartDelay(2, 60, n.failures-1))
+	log.Printf("Network output stopped: %s", msg)
+}
+
+func (n *NetworkOutput) pipelineArgs(tap TapInfo) []string {
+	cfg := n.config
+	args := []string{"-e"}
+	args = append(args, TapSource(tap)...)
+	args = append(args,
+		"!", "queue", "max-size-buffers=30", "leaky=downstream",
+		"!", "videoscale",
+		"!", "videoconvert",
+	)
+	if cfg.Width > 0 {
+		args = append(args, "!", fmt.Sprintf("video/x-raw,width=%d,pixel-aspect-ratio=1/1", cfg.Width))
+	}
+	args = append(args, h264EncoderArgs(n.encoder, cfg.BitrateKbps)...)
+	args = append(args, "!", "h264parse")
+
+	if n.protocol == NetworkRTSP {
+		return append(args, "!", "rtspclientsink",
+			fmt.Sprintf("location=%s", cfg.RTSPURL), "protocols=tcp", "latency=0")
+	}
+	return append(args, "!", "hlssink2",
+		fmt.Sprintf("location=%s", filepath.Join(n.dir, hlsSegmentPrefix+"%05d.ts")),
+		fmt.Sprintf("playlist-location=%s", filepath.Join(n.dir, HLSPlaylist)),
+		fmt.Sprintf("target-duration=%d", cfg.SegmentSec),
+		fmt.Sprintf("playlist-length=%d", cfg.PlaylistLength),
+		// сегменты, только что вытесненные из плейлиста, еще могут скачиваться
+		fmt.Sprintf("max-files=%d", cfg.PlaylistLength+2),
+	)
+}
+
+// removeSegments вызывается под mu.
+func (n *NetworkOutput) removeSegments() {
+	paths, _ := filepath.Glob(filepath.Join(n.dir, hlsSegmentPrefix+"*.ts"))
+	for _, p := range append(paths, filepath.Join(n.dir, HLSPlaylist)) {
+		os.Remove(p)
+	}
+}
+
+// HLSFile возвращает путь к плейлисту или сегменту для веб-сервера.
+func (n *NetworkOutput) HLSFile(name string) (string, error) {
+	n.mu.Lock()
+	running, protocol, dir := n.running, n.protocol, n.dir
+	n.mu.Unlock()
+
+	if !running || protocol != NetworkHLS {
+		return "", fmt.Errorf("HLS output is not enabled")
+	}
+	if name != filepath.Base(name) || (name != HLSPlaylist && !strings.HasSuffix(name, ".ts")) {
+		return "", fmt.Errorf("invalid HLS file name %q", name)
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%s not found", name)
+	}
+	return path, nil
+}
+
+// Status - состояние сетевого вывода для API статуса.
+func (n *NetworkOutput) Status() map[string]interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	state := NetworkStopped
+	switch {
+	case n.running && n.cmd != nil:
+		state = NetworkActive
+	case n.running:
+		state = NetworkWaiting
+	}
+	status := map[string]interface{}{
+		"state": state,
+	}
+	if !n.running {
+		return status
+	}
+	status["protocol"] = n.protocol
+	status["encoder"] = n.encoder
+	if n.protocol == NetworkRTSP {
+		if u, err := url.Parse(n.config.RTSPURL); err == nil {
+			status["url"] = u.Redacted()
+		}
+	} else {
+		status["url"] = "/api/hls/" + HLSPlaylist
+	}
+	if n.lastError != "" {
+		status["last_error"] = n.lastError
+	}
+	return status
+}
+
+// ValidateNetwork проверяет настройки сетевого вывода.
+func ValidateNetwork(cfg models.NetworkConfig) error {
+	var problems []string
+	switch cfg.Protocol {
+	case NetworkHLS:
+		if cfg.Dir == "" {
+			problems = append(problems, "dir is required for hls")
+		}
+	case NetworkRTSP:
+		if !cfg.Enabled {
+			break
+		}
+		if u, err := url.Parse(cfg.RTSPURL); err != nil || (u.Scheme != "rtsp" && u.Scheme != "rtsps") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("rtsp_url must point to an external RTSP server like rtsp://host:8554/path, got %q", cfg.RTSPURL))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("protocol must be hls or rtsp, got %q", cfg.Protocol))
+	}
+	switch cfg.Encoder {
+	case "", "auto", "vaapi", "x264":
+	default:
+		problems = append(problems, fmt.Sprintf("encoder must be auto, vaapi or x264, got %q", cfg.Encoder))
+	}
+	if cfg.Width < 0 || cfg.Width%2 != 0 {
+		problems = append(problems, "width must be 0 or a positive even number")
+	}
+	if cfg.BitrateKbps <= 0 {
+		problems = append(problems, "bitrate_kbps must be positive")
+	}
+	if cfg.SegmentSec <= 0 || cfg.PlaylistLength <= 0 {
+		problems = append(problems, "segment_sec and playlist_length must be positive")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
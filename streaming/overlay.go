@@ -0,0 +1,360 @@
+package streaming
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rentiga-device/models"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	OverlayClock   = "clock"
+	OverlaySession = "session"
+	OverlayMessage = "message"
+)
+
+const overlayMargin = 40
+
+var overlayPositions = map[string]bool{
+	"top-left": true, "top": true, "top-right": true,
+	"center": true,
+	"bottom-left": true, "bottom": true, "bottom-right": true,
+}
+
+// Overlay рисует текстовую плашку в PNG размером с кадр. Пайплайн перечитывает
+// файл раз в секунду (multifilesrc loop=true), поэтому текст, режим и даже позицию
+// можно менять без перезапуска: достаточно перерисовать файл.
+type Overlay struct {
+	mu      sync.Mutex
+	cfg     models.OverlayConfig
+	font    string
+	path    string
+	width   int
+	height  int
+	face    font.Face
+	last    string
+	stop    chan struct{}
+	stopped chan struct{}
+
+	// Remaining возвращает остаток времени сеанса для режима "session"
+	Remaining func() (time.Duration, bool)
+}
+
+func NewOverlay(cfg models.OverlayConfig, fontPath, dir string) *Overlay {
+	return &Overlay{
+		cfg:  cfg,
+		font: fontPath,
+		path: filepath.Join(dir, "overlay.png"),
+	}
+}
+
+// ValidateOverlay проверяет настройки плашки, не открывая файл шрифта.
+func ValidateOverlay(cfg models.OverlayConfig) error {
+	switch cfg.Mode {
+	case "", OverlayClock, OverlaySession, OverlayMessage:
+	default:
+		return fmt.Errorf("unknown overlay mode %q", cfg.Mode)
+	}
+	if cfg.Position != "" && !overlayPositions[cfg.Position] {
+		return fmt.Errorf("unknown overlay position %q", cfg.Position)
+	}
+	if cfg.FontSize < 0 {
+		return fmt.Errorf("overlay font size must not be negative")
+	}
+	if _, err := ParseColor(cfg.Color); cfg.Color != "" && err != nil {
+		return err
+	}
+	if _, err := ParseColor(cfg.BackgroundColor); cfg.BackgroundColor != "" && err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseColor разбирает цвет вида "#RRGGBB" или "#RRGGBBAA".
+func ParseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q, expected #RRGGBB or #RRGGBBAA", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// Path - файл, который читает пайплайн.
+func (o *Overlay) Path() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.path
+}
+
+// SetFiles меняет шрифт и каталог файла плашки. Вызывается при остановленном
+// пайплайне: шрифт загружается и путь передается пайплайну при следующем Start.
+func (o *Overlay) SetFiles(fontPath, dir string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.font = fontPath
+	o.path = filepath.Join(dir, "overlay.png")
+}
+
+// Start рисует первый кадр плашки (он должен существовать до запуска пайплайна)
+// и запускает ежесекундную перерисовку.
+func (o *Overlay) Start(width, height int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.stop != nil {
+		return nil
+	}
+
+	face, err := loadFace(o.font, o.cfg.FontSize)
+	if err != nil {
+		return err
+	}
+	o.face = face
+	o.width, o.height = width, height
+	o.last = ""
+
+	if err := os.MkdirAll(filepath.Dir(o.path), 0755); err != nil {
+		return err
+	}
+	if err := o.render(); err != nil {
+		return err
+	}
+
+	o.stop = make(chan struct{})
+	o.stopped = make(chan struct{})
+	go o.loop(o.stop, o.stopped)
+	return nil
+}
+
+func (o *Overlay) Stop() {
+	o.mu.Lock()
+	stop, stopped := o.stop, o.stopped
+	o.stop = nil
+	o.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+}
+
+func (o *Overlay) loop(stop, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			o.mu.Lock()
+			if err := o.render(); err != nil {
+				log.Printf("Overlay render error: %v", err)
+			}
+			o.mu.Unlock()
+		}
+	}
+}
+
+// Update меняет настройки плашки на лету. Размер шрифта применяется сразу,
+// если файл шрифта удается загрузить.
+func (o *Overlay) Update(cfg models.OverlayConfig) error {
+	if err := ValidateOverlay(cfg); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.face != nil && cfg.FontSize != o.cfg.FontSize {
+		face, err := loadFace(o.font, cfg.FontSize)
+		if err != nil {
+			return err
+		}
+		o.face = face
+	}
+	o.cfg = cfg
+	o.last = ""
+
+	if o.stop == nil {
+		return nil
+	}
+	return o.render()
+}
+
+// Config возвращает текущие настройки плашки.
+func (o *Overlay) Config() models.OverlayConfig {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.cfg
+}
+
+// text вызывается под mu.
+func (o *Overlay) text() string {
+	switch o.cfg.Mode {
+	case OverlayMessage:
+		return o.cfg.Message
+	case OverlaySession:
+		if o.Remaining == nil {
+			return ""
+		}
+		left, ok := o.Remaining()
+		if !ok {
+			return ""
+		}
+		return formatDuration(left)
+	default:
+		layout := o.cfg.ClockFormat
+		if layout == "" {
+			layout = "15:04:05"
+		}
+		return time.Now().Format(layout)
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	total := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", total/3600, total/60%60, total%60)
+}
+
+// render вызывается под mu. Файл подменяется атомарно, чтобы пайплайн
+// никогда не прочитал недописанный PNG.
+func (o *Overlay) render() error {
+	text := o.text()
+	if text == o.last {
+		return nil
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, o.width, o.height))
+	if text != "" {
+		o.drawText(img, text)
+	}
+
+	tmp := o.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return err
+	}
+
+	o.last = text
+	return nil
+}
+
+func (o *Overlay) drawText(img *image.NRGBA, text string) {
+	fg, err := ParseColor(o.cfg.Color)
+	if err != nil {
+		fg = color.NRGBA{R: 255, G: 255, B: 255, A: 230}
+	}
+
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(fg), Face: o.face}
+	metrics := o.face.Metrics()
+	textW := d.MeasureString(text).Ceil()
+	textH := (metrics.Ascent + metrics.Descent).Ceil()
+	pad := textH / 5
+
+	boxW, boxH := textW+2*pad, textH+2*pad
+	x, y := o.anchor(boxW, boxH)
+
+	if o.cfg.BackgroundColor != "" {
+		if bg, err := ParseColor(o.cfg.BackgroundColor); err == nil {
+			draw.Draw(img, image.Rect(x, y, x+boxW, y+boxH), image.NewUniform(bg), image.Point{}, draw.Over)
+		}
+	}
+
+	d.Dot = fixed.Point26_6{
+		X: fixed.I(x + pad),
+		Y: fixed.I(y+pad) + metrics.Ascent,
+	}
+	d.DrawString(text)
+}
+
+// anchor возвращает левый верхний угол плашки размером w x h.
+func (o *Overlay) anchor(w, h int) (int, int) {
+	left, centerX, right := overlayMargin, (o.width-w)/2, o.width-w-overlayMargin
+	top, centerY, bottom := overlayMargin, (o.height-h)/2, o.height-h-overlayMargin
+
+	switch o.cfg.Position {
+	case "top-left":
+		return left, top
+	case "top":
+		return centerX, top
+	case "top-right":
+		return right, top
+	case "center":
+		return centerX, centerY
+	case "bottom-left":
+		return left, bottom
+	case "bottom-right":
+		return right, bottom
+	default:
+		return centerX, bottom
+	}
+}
+
+// loadFace загружает TTF/OTF из fontPath; без файла используется встроенный Go Bold.
+func loadFace(fontPath string, size int) (font.Face, error) {
+	if size <= 0 {
+		size = 100
+	}
+
+	data := gobold.TTF
+	if fontPath != "" {
+		var err error
+		data, err = os.ReadFile(fontPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read overlay font: %v", err)
+		}
+	}
+
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse overlay font %s: %v", fontPath, err)
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    float64(size),
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
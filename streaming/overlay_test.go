@@ -0,0 +1,34 @@
+package streaming
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{"#000000", color.NRGBA{0, 0, 0, 0xff}, false},
+		{"#ff8000", color.NRGBA{0xff, 0x80, 0x00, 0xff}, false},
+		{"#FF800080", color.NRGBA{0xff, 0x80, 0x00, 0x80}, false},
+		{"ff8000", color.NRGBA{0xff, 0x80, 0x00, 0xff}, false},
+		{"#fff", color.NRGBA{}, true},
+		{"#ff80000", color.NRGBA{}, true},
+		{"#gg0000", color.NRGBA{}, true},
+		{"", color.NRGBA{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseColor(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseColor(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
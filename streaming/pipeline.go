@@ -0,0 +1,78 @@
+package streaming
+
+import (
+	"fmt"
+	"sort"
+
+	"rentiga-device/models"
+)
+
+const (
+	BackendGStreamer = "gstreamer"
+	BackendFFmpeg    = "ffmpeg"
+	BackendTest      = "test"
+)
+
+// PipelineParams - все, что нужно бэкенду для сборки командной строки потока.
+type PipelineParams struct {
+	Config      *models.StreamConfig
+	Device      string // текущий узел устройства захвата (после переподключения может отличаться от Config.Device)
+	Width       int
+	Height      int
+	OverlayPath string // пусто, если плашка выключена
+	Decoder     string // цепочка декодирования для {{.Decoder}}, только gstreamer
+
+	Capture *VideoDevice // возможности устройства захвата; nil - режим берется из конфига как есть
+	Mode    *CaptureMode // бэкенд записывает сюда согласованный режим
+	Tap     *TapInfo     // nil - отвод кадров выключен; бэкенд ставит Active, если встроил его
+}
+
+// negotiate согласует режим для формата fourcc и запоминает его в p.Mode.
+func (p PipelineParams) negotiate(fourcc string) (CaptureMode, error) {
+	mode, err := NegotiateMode(p.Capture, fourcc, p.Width, p.Height, p.Config.Framerate)
+	if err != nil {
+		return mode, err
+	}
+	if p.Mode != nil {
+		*p.Mode = mode
+	}
+	return mode, nil
+}
+
+// Pipeline - бэкенд, который превращает настройки потока в команду внешнего процесса.
+// Процессом управляет Streamer (супервизор), бэкенд только строит аргументы.
+type Pipeline interface {
+	Name() string
+	// StreamCommand - захват с устройства и вывод на экран.
+	StreamCommand(p PipelineParams) (string, []string, error)
+	// ImageCommand - бесконечный показ PNG, который перечитывается раз в секунду (заставка).
+	ImageCommand(cfg *models.StreamConfig, imagePath string) (string, []string, error)
+}
+
+var pipelines = map[string]Pipeline{
+	BackendGStreamer: gstreamerPipeline{},
+	BackendFFmpeg:    ffmpegPipeline{},
+	BackendTest:      testPipeline{},
+}
+
+// PipelineFor возвращает бэкенд по имени из StreamConfig.Backend; пустое имя - GStreamer.
+func PipelineFor(name string) (Pipeline, error) {
+	if name == "" {
+		name = BackendGStreamer
+	}
+	p, ok := pipelines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pipeline backend %q (available: %v)", name, Backends())
+	}
+	return p, nil
+}
+
+// Backends - имена доступных бэкендов.
+func Backends() []string {
+	names := make([]string, 0, len(pipelines))
+	for name := range pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
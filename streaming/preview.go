@@ -0,0 +1,200 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+
+	"rentiga-device/models"
+)
+
+// PreviewBoundary - граница частей multipart/x-mixed-replace в выводе multipartmux.
+const PreviewBoundary = "frame"
+
+var ErrPreviewBusy = errors.New("too many preview viewers")
+
+// Previewer отдает уменьшенный MJPEG-поток для удаленной проверки картинки.
+// Пока идет трансляция, кадры берутся из отвода пайплайна; без трансляции -
+// прямо с устройства захвата. Каждый зритель получает свой процесс gst-launch.
+type Previewer struct {
+	mu       sync.Mutex
+	config   models.PreviewConfig
+	streamer *Streamer
+	viewers  int
+	nextID   int
+	direct   map[int]*directPreview // превью, занявшие устройство захвата
+	reserved bool                   // устройство отдано запускаемой трансляции
+}
+
+type directPreview struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewPreviewer(cfg models.PreviewConfig, streamer *Streamer) *Previewer {
+	return &Previewer{
+		config:   cfg,
+		streamer: streamer,
+		direct:   make(map[int]*directPreview),
+	}
+}
+
+// Serve пишет multipart MJPEG в w, пока ctx не отменен или не завершился процесс
+// (например, при перезапуске пайплайна - клиент переподключится сам).
+func (p *Previewer) Serve(ctx context.Context, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p.mu.Lock()
+	if p.config.MaxViewers > 0 && p.viewers >= p.config.MaxViewers {
+		p.mu.Unlock()
+		return ErrPreviewBusy
+	}
+
+	source, direct, err := p.source()
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+
+	cfg := p.config
+	id := p.nextID
+	p.nextID++
+	p.viewers++
+	done := make(chan struct{})
+	if direct {
+		p.direct[id] = &directPreview{cancel: cancel, done: done}
+	}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.viewers--
+		delete(p.direct, id)
+		p.mu.Unlock()
+		close(done)
+	}()
+
+	args := append([]string{"-q"}, source...)
+	args = append(args, encodeArgs(cfg)...)
+
+	cmd := exec.CommandContext(ctx, "gst-launch-1.0", args...)
+	cmd.Stdout = w
+	stderr := newTailBuffer(4096)
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		// зритель ушел или устройство понадобилось трансляции
+		return nil
+	}
+	if err != nil {
+		log.Printf("Preview pipeline exited: %s", describeExit(err, stderr.String()))
+		return fmt.Errorf("preview failed: %s", describeExit(err, stderr.String()))
+	}
+	return nil
+}
+
+// source выбирает источник кадров. Вызывается под mu.
+func (p *Previewer) source() ([]string, bool, error) {
+	if tap, ok := p.streamer.Tap(); ok {
+		return TapSource(tap), false, nil
+	}
+	if p.streamer.Wanted() {
+		return nil, false, fmt.Errorf("preview is not available: pipeline has no frame tap or capture device is missing")
+	}
+	if p.reserved {
+		return nil, false, fmt.Errorf("preview is not available: stream is starting")
+	}
+	// устройство может открыть только один процесс
+	if len(p.direct) > 0 {
+		return nil, false, ErrPreviewBusy
+	}
+
+	device, resolution := p.streamer.CaptureSource()
+	args := []string{"v4l2src", fmt.Sprintf("device=%s", device)}
+	width, height, _ := ParseResolution(resolution)
+	if dev, err := ProbeVideoDevice(device); err == nil {
+		if mode, err := NegotiateMode(dev, "MJPG", width, height, ""); err == nil {
+			return append(args, "!", modeCaps("image/jpeg", mode), "!", "jpegdec"), true, nil
+		}
+	}
+	return args, true, nil
+}
+
+func encodeArgs(cfg models.PreviewConfig) []string {
+	return []string{
+		"!", "queue", "max-size-buffers=2", "leaky=downstream",
+		"!", "videorate", "drop-only=true",
+		"!", fmt.Sprintf("video/x-raw,framerate=%s", cfg.Framerate),
+		"!", "videoscale",
+		"!", "videoconvert",
+		"!", fmt.Sprintf("video/x-raw,width=%d", cfg.Width),
+		"!", "jpegenc", fmt.Sprintf("quality=%d", cfg.Quality),
+		"!", "multipartmux", fmt.Sprintf("boundary=%s", PreviewBoundary),
+		"!", "fdsink", "fd=1",
+	}
+}
+
+// Update меняет настройки превью для новых зрителей; открытые потоки не меняются.
+func (p *Previewer) Update(cfg models.PreviewConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.config = cfg
+}
+
+// ReleaseDevice закрывает превью, которые читают устройство напрямую, и ждет
+// завершения их процессов: вызывается перед запуском трансляции. До ReturnDevice
+// новые превью не открывают устройство, чтобы не занять его раньше пайплайна.
+func (p *Previewer) ReleaseDevice() {
+	p.mu.Lock()
+	p.reserved = true
+	var pending []chan struct{}
+	for _, d := range p.direct {
+		d.cancel()
+		pending = append(pending, d.done)
+	}
+	p.mu.Unlock()
+
+	for _, done := range pending {
+		<-done
+	}
+}
+
+// ReturnDevice снимает резерв ReleaseDevice, когда запуск трансляции закончен,
+// успешно или нет.
+func (p *Previewer) ReturnDevice() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reserved = false
+}
+
+func (p *Previewer) Viewers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.viewers
+}
+
+// ValidatePreview проверяет настройки превью.
+func ValidatePreview(cfg models.PreviewConfig) error {
+	if cfg.Width <= 0 || cfg.Width%2 != 0 {
+		return fmt.Errorf("width must be a positive even number")
+	}
+	if _, _, err := ParseFramerate(cfg.Framerate); err != nil {
+		return err
+	}
+	if cfg.Quality < 1 || cfg.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	if cfg.MaxViewers < 0 {
+		return fmt.Errorf("max_viewers must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"rentiga-device/models"
+)
+
+const (
+	RecordingStopped = "stopped"
+	RecordingWaiting = "waiting" // запись запрошена, но отвода кадров нет (поток не запущен)
+	RecordingActive  = "recording"
+)
+
+const (
+	recordingPrefix     = "rec-"
+	recorderPoll        = 2 * time.Second
+	recorderStopTimeout = 10 * time.Second
+)
+
+var unsafeLabel = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// Recorder пишет кадры из отвода пайплайна в сегменты MP4/MKV отдельным
+// процессом: запуск и остановка записи не трогают вывод на экран. Если отвода
+// нет (поток остановлен или перезапускается), запись ждет и продолжается сама.
+type Recorder struct {
+	mu         sync.Mutex
+	config     models.RecordingConfig
+	tap        func() (TapInfo, bool)
+	wanted     bool
+	label      string
+	startedAt  time.Time
+	cmd        *exec.Cmd
+	done       chan struct{}
+	loopStop   chan struct{}
+	failures   int
+	launchedAt time.Time
+	retryAt    time.Time
+	lastError  string
+	encoder    string
+}
+
+func NewRecorder(cfg models.RecordingConfig, tap func() (TapInfo, bool)) *Recorder {
+	return &Recorder{config: cfg, tap: tap}
+}
+
+// Update меняет настройки записи без перезапуска вывода на экран. Если поменялось
+// то, что влияет на процесс записи, текущий сегмент закрывается и следующий
+// пишется уже с новыми настройками; ограничения хранения действуют сразу.
+func (r *Recorder) Update(cfg models.RecordingConfig) error {
+	r.mu.Lock()
+	old := r.config
+	if r.wanted && cfg.Dir != old.Dir {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			r.mu.Unlock()
+			return fmt.Errorf("failed to create recording dir: %v", err)
+		}
+	}
+	r.config = cfg
+	relaunch := cfg.Dir != old.Dir || cfg.Format != old.Format || cfg.Encoder != old.Encoder ||
+		cfg.SegmentSec != old.SegmentSec || cfg.BitrateKbps != old.BitrateKbps
+	if relaunch {
+		r.encoder = ""
+	}
+	r.mu.Unlock()
+
+	if relaunch {
+		r.Detach()
+	}
+	return nil
+}
+
+// Detach закрывает текущий сегмент через EOS, не выключая запись: процесс
+// поднимется снова, когда отвод кадров появится. Вызывается перед остановкой
+// пайплайна - иначе процесс записи падает вместе с отводом и MP4 остается
+// незакрытым.
+func (r *Recorder) Detach() {
+	r.mu.Lock()
+	cmd, done := r.cmd, r.done
+	// wait не считает такой выход сбоем; пайплайн успеет остановиться до следующей попытки
+	r.cmd = nil
+	r.retryAt = time.Now().Add(recorderPoll)
+	r.mu.Unlock()
+
+	if cmd != nil {
+		stopProcess(cmd, done, recorderStopTimeout)
+	}
+}
+
+// Start включает запись; label (например, ID сеанса) попадает в имена файлов.
+func (r *Recorder) Start(label string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.wanted {
+		return fmt.Errorf("recording already started")
+	}
+	if err := os.MkdirAll(r.config.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create recording dir: %v", err)
+	}
+
+	r.wanted = true
+	r.encoder = "" // кодер выбирается заново: конфиг мог измениться
+	r.label = unsafeLabel.ReplaceAllString(label, "_")
+	r.startedAt = time.Now()
+	r.failures = 0
+	r.retryAt = time.Time{}
+	r.lastError = ""
+	r.loopStop = make(chan struct{})
+	go r.loop(r.loopStop)
+	return nil
+}
+
+// Stop завершает текущий сегмент (EOS, чтобы MP4 был корректно закрыт) и выключает запись.
+func (r *Recorder) Stop() {
+	r.mu.Lock()
+	if !r.wanted {
+		r.mu.Unlock()
+		return
+	}
+	r.wanted = false
+	close(r.loopStop)
+	cmd, done := r.cmd, r.done
+	r.mu.Unlock()
+
+	if cmd != nil {
+		stopProcess(cmd, done, recorderStopTimeout)
+	}
+	r.enforceRetention()
+}
+
+func (r *Recorder) Recording() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.wanted
+}
+
+func (r *Recorder) loop(stop chan struct{}) {
+	ticker := time.NewTicker(recorderPoll)
+	defer ticker.Stop()
+
+	r.tick()
+	retention := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.tick()
+			if time.Since(retention) >= time.Minute {
+				r.enforceRetention()
+				retention = time.Now()
+			}
+		}
+	}
+}
+
+// tick запускает процесс записи, когда появился отвод кадров.
+func (r *Recorder) tick() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.wanted || r.cmd != nil || time.Now().Before(r.retryAt) {
+		return
+	}
+	tap, ok := r.tap()
+	if !ok {
+		return
+	}
+
+	args := r.pipelineArgs(tap)
+	cmd := exec.Command("gst-launch-1.0", args...)
+	stderr := newTailBuffer(stderrTailLimit)
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		r.failed(fmt.Sprintf("failed to start recorder: %v", err))
+		return
+	}
+
+	log.Printf("Recording to %s", r.config.Dir)
+	r.cmd = cmd
+	r.done = make(chan struct{})
+	r.launchedAt = time.Now()
+	go r.wait(cmd, r.done, stderr)
+}
+
+func (r *Recorder) wait(cmd *exec.Cmd, done chan struct{}, stderr *tailBuffer) {
+	err := cmd.Wait()
+
+	r.mu.Lock()
+	current := r.cmd == cmd
+	if current {
+		r.cmd = nil
+	}
+	if r.wanted && current {
+		// пайплайн мог перезапуститься - пробуем снова, но не чаще, чем позволяет backoff
+		if time.Since(r.launchedAt) >= time.Minute {
+			r.failures = 0
+		}
+		r.failed(describeExit(err, stderr.String()))
+	}
+	r.mu.Unlock()
+	close(done)
+}
+
+// failed вызывается под mu.
+func (r *Recorder) failed(msg string) {
+	r.failures++
+	r.lastError = msg
+	r.retryAt = time.Now().Add(restartDelay(2, 60, r.failures-1))
+	log.Printf("Recorder stopped: %s", msg)
+}
+
+func (r *Recorder) pipelineArgs(tap TapInfo) []string {
+	cfg := r.config
+	muxer := []string{"muxer-factory=mp4mux",
+		// фрагментированный MP4 читается и без финального moov: процесс записи
+		// падает без EOS, если пайплайн упал раньше
+		"muxer-properties=properties,fragment-duration=1000"}
+	if cfg.Format == "mkv" {
+		muxer = []string{"muxer-factory=matroskamux"}
+	}
+	location := filepath.Join(cfg.Dir, fmt.Sprintf("%s%s%s-%%05d.%s",
+		recordingPrefix, labelPart(r.label), time.Now().UTC().Format("20060102T150405Z"), cfg.Format))
+
+	args := []string{"-e"}
+	args = append(args, TapSource(tap)...)
+	args = append(args,
+		"!", "queue", "max-size-buffers=30", "leaky=downstream",
+		"!", "videoconvert",
+	)
+	args = append(args, r.encoderArgs()...)
+	args = append(args,
+		"!", "h264parse",
+		"!", "splitmuxsink",
+		fmt.Sprintf("location=%s", location),
+		fmt.Sprintf("max-size-time=%d", time.Duration(cfg.SegmentSec)*time.Second),
+	)
+	return append(args, muxer...)
+}
+
+// encoderArgs выбирает кодер при первом запуске записи. Вызывается под mu.
+func (r *Recorder) encoderArgs() []string {
+	if r.encoder == "" {
+		r.encoder = resolveEncoder(r.config.Encoder)
+	}
+	return h264EncoderArgs(r.encoder, r.config.BitrateKbps)
+}
+
+// resolveEncoder выбирает H.264-кодер для "auto": VA-API, если есть, иначе x264.
+func resolveEncoder(name string) string {
+	if name != "" && name != "auto" {
+		return name
+	}
+	if elementExists("vaapih264enc") {
+		return "vaapi"
+	}
+	return "x264"
+}
+
+func h264EncoderArgs(encoder string, bitrateKbps int) []string {
+	bitrate := fmt.Sprintf("bitrate=%d", bitrateKbps)
+	if encoder == "vaapi" {
+		return []string{"!", "vaapih264enc", bitrate, "keyframe-period=60"}
+	}
+	return []string{"!", "x264enc", bitrate, "tune=zerolatency", "speed-preset=veryfast", "key-int-max=60"}
+}
+
+func labelPart(label string) string {
+	if label == "" {
+		return ""
+	}
+	return label + "-"
+}
+
+type recording struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func recordings(dir string) []recording {
+	paths, _ := filepath.Glob(filepath.Join(dir, recordingPrefix+"*"))
+	files := make([]recording, 0, len(paths))
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, recording{p, info.Size(), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	return files
+}
+
+// enforceRetention удаляет записи старше max_age_hours, затем самые старые,
+// пока общий объем не уложится в max_size_mb. Последний файл не трогается:
+// в него может идти запись.
+func (r *Recorder) enforceRetention() {
+	r.mu.Lock()
+	cfg := r.config
+	r.mu.Unlock()
+
+	files := recordings(cfg.Dir)
+	if len(files) < 2 {
+		return
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	files = files[:len(files)-1]
+
+	maxAge := time.Duration(cfg.MaxAgeHours) * time.Hour
+	maxSize := int64(cfg.MaxSizeMB) * 1024 * 1024
+	for _, f := range files {
+		expired := maxAge > 0 && time.Since(f.modTime) > maxAge
+		oversize := maxSize > 0 && total > maxSize
+		if !expired && !oversize {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			log.Printf("Failed to remove old recording: %v", err)
+			continue
+		}
+		total -= f.size
+	}
+}
+
+// Status - состояние записи для API статуса.
+func (r *Recorder) Status() map[string]interface{} {
+	r.mu.Lock()
+	state := RecordingStopped
+	switch {
+	case r.wanted && r.cmd != nil:
+		state = RecordingActive
+	case r.wanted:
+		state = RecordingWaiting
+	}
+	status := map[string]interface{}{
+		"state": state,
+		"dir":   r.config.Dir,
+	}
+	if r.wanted {
+		status["label"] = r.label
+		status["started_at"] = r.startedAt.UTC()
+	}
+	if r.encoder != "" {
+		status["encoder"] = r.encoder
+	}
+	if r.lastError != "" {
+		status["last_error"] = r.lastError
+	}
+	dir := r.config.Dir
+	r.mu.Unlock()
+
+	files := recordings(dir)
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	status["files"] = len(files)
+	status["disk_usage_mb"] = total / (1024 * 1024)
+	if len(files) > 0 {
+		status["latest_file"] = filepath.Base(files[len(files)-1].path)
+	}
+	return status
+}
+
+// ValidateRecording проверяет настройки записи.
+func ValidateRecording(cfg models.RecordingConfig) error {
+	var problems []string
+	if cfg.Dir == "" {
+		problems = append(problems, "dir is required")
+	}
+	if cfg.Format != "mp4" && cfg.Format != "mkv" {
+		problems = append(problems, fmt.Sprintf("format must be mp4 or mkv, got %q", cfg.Format))
+	}
+	switch cfg.Encoder {
+	case "", "auto", "vaapi", "x264":
+	default:
+		problems = append(problems, fmt.Sprintf("encoder must be auto, vaapi or x264, got %q", cfg.Encoder))
+	}
+	if cfg.SegmentSec <= 0 {
+		problems = append(problems, "segment_sec must be positive")
+	}
+	if cfg.BitrateKbps <= 0 {
+		problems = append(problems, "bitrate_kbps must be positive")
+	}
+	if cfg.MaxSizeMB < 0 || cfg.MaxAgeHours < 0 {
+		problems = append(problems, "max_size_mb and max_age_hours must not be negative")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// stopProcess просит gst-launch завершиться через EOS и ждет, пока не выйдет timeout.
+func stopProcess(cmd *exec.Cmd, done chan struct{}, timeout time.Duration) {
+	cmd.Process.Signal(syscall.SIGINT)
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("Process %d did not stop in %s, killing it", cmd.Process.Pid, timeout)
+		cmd.Process.Kill()
+		<-done
+	}
+}
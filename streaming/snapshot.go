@@ -0,0 +1,89 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const snapshotTimeout = 15 * time.Second
+
+const (
+	SnapshotFromPipeline = "pipeline"
+	SnapshotFromDevice   = "device"
+)
+
+// Snapshot сохраняет один кадр в JPEG: из отвода работающего пайплайна или,
+// если поток не запущен, прямо с устройства захвата. Возвращает источник кадра.
+func (s *Streamer) Snapshot(path string, quality int) (string, error) {
+	s.mu.Lock()
+	wanted, running, tap := s.wanted, s.cmd != nil, s.tap
+	device := s.source
+	if device == "" {
+		device = s.config.Device
+	}
+	width, height, _ := ParseResolution(s.config.Resolution)
+	s.mu.Unlock()
+
+	var args []string
+	source := SnapshotFromPipeline
+	switch {
+	case running && tap.Active:
+		args = append(TapSource(tap, "num-buffers=1"),
+			"!", "videoconvert", "!", "jpegenc", fmt.Sprintf("quality=%d", quality))
+	case running || wanted:
+		// устройство занято пайплайном без отвода или его сейчас нет
+		return "", fmt.Errorf("snapshot is not available: pipeline has no frame tap or capture device is missing")
+	default:
+		source = SnapshotFromDevice
+		args = deviceSnapshotArgs(device, width, height, quality)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	// multifilesink без шаблона в имени перезаписывает файл - остается последний кадр
+	args = append(args, "!", "multifilesink", fmt.Sprintf("location=%s", tmp))
+
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "gst-launch-1.0", append([]string{"-q"}, args...)...).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("snapshot timed out after %s", snapshotTimeout)
+		}
+		return "", fmt.Errorf("snapshot failed: %v: %s", err, lastLine(string(out)))
+	}
+	if info, err := os.Stat(tmp); err != nil || info.Size() == 0 {
+		os.Remove(tmp)
+		return "", fmt.Errorf("snapshot failed: no frame captured")
+	}
+	return source, os.Rename(tmp, path)
+}
+
+// deviceSnapshotArgs снимает несколько кадров с устройства и оставляет последний:
+// первые кадры после открытия у многих донглов черные.
+func deviceSnapshotArgs(device string, width, height, quality int) []string {
+	args := []string{"v4l2src", fmt.Sprintf("device=%s", device), "num-buffers=5"}
+
+	dev, err := ProbeVideoDevice(device)
+	if err == nil {
+		if mode, err := NegotiateMode(dev, "MJPG", width, height, ""); err == nil {
+			// устройство само отдает JPEG, перекодировать не нужно
+			return append(args, "!", modeCaps("image/jpeg", mode))
+		}
+	}
+	return append(args, "!", "videoconvert", "!", "jpegenc", fmt.Sprintf("quality=%d", quality))
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
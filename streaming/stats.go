@@ -0,0 +1,233 @@
+package streaming
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsElement - имя fpsdisplaysink во встроенных шаблонах. gst-launch -v печатает
+// его last-message раз в секунду, из него берутся кадры и fps. Свои шаблоны
+// получают статистику, если тоже оборачивают синк в fpsdisplaysink name=stats.
+const statsElement = "stats"
+
+var (
+	fpsMessage = regexp.MustCompile(`:` + statsElement +
+		`: last-message = rendered: (\d+), dropped: (\d+), current: ([\d.]+), average: ([\d.]+)`)
+	queueLeak   = regexp.MustCompile(`<([^>]+)> queue is full, leaking`)
+	latencyTime = regexp.MustCompile(`time=\(guint64\)(\d+)`)
+)
+
+// PipelineMetrics - показатели работающего пайплайна; обнуляются при каждом запуске.
+type PipelineMetrics struct {
+	FramesRendered uint64            `json:"frames_rendered"`
+	FramesDropped  uint64            `json:"frames_dropped"` // отброшены синком (QoS)
+	QueueDropped   uint64            `json:"queue_dropped"`  // выброшены leaky-очередями, только с stream.measure_queue_drops
+	QueueDrops     map[string]uint64 `json:"queue_drops,omitempty"`
+	FPS            float64           `json:"fps"`
+	AverageFPS     float64           `json:"average_fps"`
+	LatencyMs      float64           `json:"latency_ms,omitempty"` // только с stream.measure_latency
+	UptimeSec      int               `json:"uptime_sec"`
+	UpdatedAt      time.Time         `json:"updated_at,omitempty"`
+}
+
+// Metrics возвращает показатели работающего пайплайна; ok=false, если он не запущен.
+func (s *Streamer) Metrics() (PipelineMetrics, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd == nil {
+		return PipelineMetrics{}, false
+	}
+	return s.metricsLocked(), true
+}
+
+// metricsLocked вызывается под mu.
+func (s *Streamer) metricsLocked() PipelineMetrics {
+	var m PipelineMetrics
+	if s.metrics != nil {
+		m = s.metrics.snapshot()
+	}
+	m.UptimeSec = int(time.Since(s.startedAt).Seconds())
+	return m
+}
+
+// metricsCollector разбирает вывод процесса пайплайна: stdout gst-launch -v
+// (fpsdisplaysink) или ffmpeg -progress, и отладочный вывод GStreamer в stderr
+// (переполнение очередей, трейсер latency).
+type metricsCollector struct {
+	mu         sync.Mutex
+	metrics    PipelineMetrics
+	latencySum float64
+	latencyN   int
+	stdout     *lineWriter
+	stderr     *lineWriter
+}
+
+func newMetricsCollector() *metricsCollector {
+	return &metricsCollector{}
+}
+
+func (c *metricsCollector) snapshot() PipelineMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.metrics
+	if len(m.QueueDrops) > 0 {
+		m.QueueDrops = make(map[string]uint64, len(c.metrics.QueueDrops))
+		for k, v := range c.metrics.QueueDrops {
+			m.QueueDrops[k] = v
+		}
+	}
+	return m
+}
+
+func (c *metricsCollector) stdoutLine(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if m := fpsMessage.FindStringSubmatch(line); m != nil {
+		c.metrics.FramesRendered, _ = strconv.ParseUint(m[1], 10, 64)
+		c.metrics.FramesDropped, _ = strconv.ParseUint(m[2], 10, 64)
+		c.metrics.FPS, _ = strconv.ParseFloat(m[3], 64)
+		c.metrics.AverageFPS, _ = strconv.ParseFloat(m[4], 64)
+		c.updated()
+		return
+	}
+
+	// ffmpeg -progress: блоки key=value, заканчивающиеся progress=continue
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok {
+		return
+	}
+	switch key {
+	case "frame":
+		c.metrics.FramesRendered, _ = strconv.ParseUint(value, 10, 64)
+	case "drop_frames":
+		c.metrics.FramesDropped, _ = strconv.ParseUint(value, 10, 64)
+	case "fps":
+		c.metrics.FPS, _ = strconv.ParseFloat(value, 64)
+	case "progress":
+		c.updated()
+	}
+}
+
+// stderrLine возвращает true, если строка - отладочный вывод, который не нужно
+// сохранять в хвосте stderr: иначе он вытеснит оттуда сообщение об ошибке.
+func (c *metricsCollector) stderrLine(line string) bool {
+	switch {
+	case strings.Contains(line, "queue_dataflow"):
+		if m := queueLeak.FindStringSubmatch(line); m != nil {
+			c.mu.Lock()
+			if c.metrics.QueueDrops == nil {
+				c.metrics.QueueDrops = make(map[string]uint64)
+			}
+			c.metrics.QueueDrops[m[1]]++
+			c.metrics.QueueDropped++
+			c.mu.Unlock()
+		}
+		return true
+	case strings.Contains(line, "GST_TRACER"):
+		// отвод кадров - тоже синк, его задержка к экрану отношения не имеет
+		if m := latencyTime.FindStringSubmatch(line); m != nil && !strings.Contains(line, "shmsink") {
+			ns, _ := strconv.ParseFloat(m[1], 64)
+			c.mu.Lock()
+			c.latencySum += ns / 1e6
+			c.latencyN++
+			c.mu.Unlock()
+		}
+		return true
+	}
+	return false
+}
+
+// updated вызывается под mu при каждом обновлении fps, примерно раз в секунду:
+// задержка усредняется по кадрам за этот интервал.
+func (c *metricsCollector) updated() {
+	c.metrics.UpdatedAt = time.Now().UTC()
+	if c.latencyN > 0 {
+		c.metrics.LatencyMs = c.latencySum / float64(c.latencyN)
+		c.latencySum, c.latencyN = 0, 0
+	}
+}
+
+// writers возвращает stdout и stderr для процесса пайплайна; остальные строки
+// stderr попадают в tail, как и раньше.
+func (c *metricsCollector) writers(tail *tailBuffer) (io.Writer, io.Writer) {
+	c.stdout = &lineWriter{line: c.stdoutLine}
+	c.stderr = &lineWriter{line: func(line string) {
+		if !c.stderrLine(line) {
+			tail.Write([]byte(line + "\n"))
+		}
+	}}
+	return c.stdout, c.stderr
+}
+
+// flush разбирает последние строки без перевода строки. Вызывается после
+// cmd.Wait, когда os/exec уже ничего не пишет: часто именно там причина выхода.
+func (c *metricsCollector) flush() {
+	for _, w := range []*lineWriter{c.stdout, c.stderr} {
+		if w != nil {
+			w.Flush()
+		}
+	}
+}
+
+// gstStatsEnv включает для gst-launch отладочный вывод, из которого
+// metricsCollector берет сброшенные очередями буферы и задержку. Без обоих
+// флагов окружение не меняется: отладочный вывод очередей тоже нагружает CPU.
+func gstStatsEnv(queueDrops, latency bool) []string {
+	var debug []string
+	env := []string{"GST_DEBUG_NO_COLOR=1"}
+	if queueDrops {
+		debug = append(debug, "queue_dataflow:5")
+	}
+	if latency {
+		debug = append(debug, "GST_TRACER:7")
+		env = append(env, "GST_TRACERS=latency")
+	}
+	if len(debug) == 0 {
+		return nil
+	}
+	if existing := os.Getenv("GST_DEBUG"); existing != "" {
+		debug = append([]string{existing}, debug...)
+	}
+	return append(env, "GST_DEBUG="+strings.Join(debug, ","))
+}
+
+// lineWriter режет вывод процесса на строки. Каждый поток процесса пишется
+// из одной горутины os/exec, поэтому блокировка не нужна.
+type lineWriter struct {
+	buf  []byte
+	line func(string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	// строка без перевода строки не должна расти бесконечно
+	if len(w.buf) > stderrTailLimit {
+		w.buf = w.buf[:0]
+	}
+	return len(p), nil
+}
+
+// Flush отдает остаток без перевода строки, если процесс завершился на нем.
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = w.buf[:0]
+	}
+}
@@ -0,0 +1,291 @@
+package streaming
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"rentiga-device/models"
+)
+
+type Streamer struct {
+    config   *models.StreamConfig
+    deviceID string
+    overlay  *Overlay
+    cmd      *exec.Cmd
+    done     chan struct{}
+    stopping bool
+    mu       sync.Mutex
+
+    // состояние супервизора, см. supervisor.go
+    wanted       bool
+    state        string
+    startedAt    time.Time
+    restarts     int
+    restartTimer *time.Timer
+    stats        PipelineStats
+    metrics      *metricsCollector
+
+    // выбор декодера, см. decoder.go
+    available   []Decoder
+    rejected    map[string]bool
+    decoder     Decoder
+    mode        CaptureMode
+    tap         TapInfo
+    stableTimer *time.Timer
+
+    // устройство захвата, см. hotplug.go
+    identity   string
+    source     string
+    sourceLost bool
+    watchStop  chan struct{}
+
+    // DecoderStatePath - файл, где запоминается рабочий декодер; пусто - не запоминать
+    DecoderStatePath string
+
+    // OnEvent получает события супервизора: EventCrashed, EventRestarted, EventFailed
+    OnEvent func(event string, data map[string]interface{})
+}
+
+// NewStreamer хранит свою копию конфига: его меняет только Update, под mu.
+func NewStreamer(cfg models.StreamConfig, deviceId string) *Streamer {
+    return &Streamer{
+        config:    &cfg,
+        deviceID:  deviceId,
+        overlay:   NewOverlay(cfg.Overlay, cfg.FontPath, cfg.TempDir),
+        state:     StateStopped,
+        // декодеры проверяются при старте, чтобы статус показывал их до первого запуска
+        available: availableDecoders(),
+    }
+}
+
+// Update заменяет конфиг потока. Идущий пайплайн его не перечитывает: настройки
+// захвата и вывода, как и шрифт и каталог плашки, действуют со следующего запуска.
+func (s *Streamer) Update(cfg models.StreamConfig) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if cfg.FontPath != s.config.FontPath || cfg.TempDir != s.config.TempDir {
+        s.overlay.SetFiles(cfg.FontPath, cfg.TempDir)
+    }
+    s.config = &cfg
+}
+
+// Overlay - текстовая плашка пайплайна; ее можно менять, не останавливая поток.
+func (s *Streamer) Overlay() *Overlay {
+    return s.overlay
+}
+
+// Start запускает пайплайн под наблюдением супервизора: при неожиданном
+// завершении он будет перезапущен, пока не исчерпан лимит перезапусков.
+// Если устройства захвата нет, поток ждет его появления и стартует сам.
+func (s *Streamer) Start() error {
+    s.mu.Lock()
+
+    if s.wanted {
+        s.mu.Unlock()
+        return fmt.Errorf("stream already running")
+    }
+
+    s.restarts = 0
+    s.identity = sourceIdentity(s.config.Device)
+    s.source = s.config.Device
+    s.sourceLost = false
+
+    if s.watchesSource() {
+        path, ok := resolveSource(s.identity)
+        if !ok {
+            s.wanted = true
+            data := s.enterWaiting()
+            s.startSourceWatch()
+            s.mu.Unlock()
+            // Start вызывают под локом приложения, а обработчик события его берет
+            go s.notify(EventSourceLost, data)
+            return nil
+        }
+        s.source = path
+    }
+
+    if err := s.launch(); err != nil {
+        s.mu.Unlock()
+        return err
+    }
+    s.wanted = true
+    s.startSourceWatch()
+    s.mu.Unlock()
+    return nil
+}
+
+// command собирает командную строку выбранного бэкенда. Вызывается под mu.
+func (s *Streamer) command() (string, []string, error) {
+    backend, err := PipelineFor(s.config.Backend)
+    if err != nil {
+        return "", nil, err
+    }
+
+    width, height, err := ParseResolution(s.config.Resolution)
+    if err != nil {
+        return "", nil, err
+    }
+
+    params := PipelineParams{
+        Config: s.config,
+        Device: s.source,
+        Width:  width,
+        Height: height,
+        Mode:   &CaptureMode{Width: width, Height: height, Framerate: s.config.Framerate},
+    }
+    if backend.Name() != BackendTest {
+        dev, err := ProbeVideoDevice(s.source)
+        if err != nil {
+            log.Printf("Capture device probe failed, using configured mode: %v", err)
+        } else {
+            params.Capture = dev
+        }
+    }
+
+    s.decoder = Decoder{}
+    if s.usesDecoder() {
+        d, err := s.selectDecoder()
+        if err != nil {
+            return "", nil, err
+        }
+        s.decoder = d
+        params.Decoder = d.Chain
+    }
+
+    overlay := s.config.Overlay.Enabled
+    if overlay {
+        params.OverlayPath = s.overlay.Path()
+    }
+
+    if s.config.FrameTap && backend.Name() != BackendFFmpeg {
+        socket := tapSocketPath(s.config.TempDir)
+        if err := prepareTap(socket); err != nil {
+            return "", nil, fmt.Errorf("failed to prepare frame tap: %v", err)
+        }
+        params.Tap = &TapInfo{SocketPath: socket}
+    }
+
+    name, args, err := backend.StreamCommand(params)
+    if err != nil {
+        return "", nil, err
+    }
+    s.mode = *params.Mode
+
+    // плашка и отвод кадров идут после преобразования кадра - размер уже другой
+    output := s.mode
+    output.Width, output.Height, err = TransformSize(s.config.Transform, s.mode.Width, s.mode.Height)
+    if err != nil {
+        return "", nil, err
+    }
+    s.tap = TapInfo{}
+    if params.Tap != nil && params.Tap.Active {
+        s.tap = *params.Tap
+        s.tap.Caps = tapCaps(output)
+    }
+
+    // плашка рисуется под согласованный размер кадра
+    if overlay {
+        if err := s.overlay.Start(output.Width, output.Height); err != nil {
+            return "", nil, fmt.Errorf("failed to start overlay: %v", err)
+        }
+    }
+    return name, args, nil
+}
+
+// launch запускает процесс пайплайна. Вызывается под mu.
+func (s *Streamer) launch() error {
+    // и для неудачного запуска: иначе handleCrash сочтет аптайм прошлого процесса
+    // стабильной работой и обнулит счетчик перезапусков
+    s.startedAt = time.Now()
+    name, args, err := s.command()
+    if err != nil {
+        return err
+    }
+
+    cmd := exec.Command(name, args...)
+
+    stderr := newTailBuffer(stderrTailLimit)
+    metrics := newMetricsCollector()
+    cmd.Stdout, cmd.Stderr = metrics.writers(stderr)
+    if name == "gst-launch-1.0" {
+        cmd.Env = append(os.Environ(), gstStatsEnv(s.config.MeasureQueueDrops, s.config.MeasureLatency)...)
+    }
+
+    if err := cmd.Start(); err != nil {
+        s.overlay.Stop()
+        log.Printf("Pipeline command: %s", strings.Join(cmd.Args, " "))
+        log.Printf("Pipeline error: %v\n%s", err, stderr.String())
+        return fmt.Errorf("failed to start stream: %v", err)
+    }
+
+    s.cmd = cmd
+    s.done = make(chan struct{})
+    s.metrics = metrics
+    s.state = StateRunning
+    if d := s.decoder; d.Name != "" {
+        s.stableTimer = time.AfterFunc(decoderStableTime(s.config.Restart.StableSec), func() {
+            s.decoderStable(d)
+        })
+    }
+    go s.wait(cmd, s.done, stderr, metrics)
+
+    return nil
+}
+
+func (s *Streamer) Stop() {
+    s.mu.Lock()
+    s.wanted = false
+    s.sourceLost = false
+    s.stopSourceWatch()
+    if s.restartTimer != nil {
+        s.restartTimer.Stop()
+        s.restartTimer = nil
+    }
+    cmd, done := s.cmd, s.done
+    if cmd == nil {
+        s.state = StateStopped
+        s.mu.Unlock()
+        return
+    }
+    s.stopping = true
+    s.mu.Unlock()
+
+    cmd.Process.Signal(syscall.SIGINT)
+    <-done
+
+    s.mu.Lock()
+    s.stopping = false
+    s.state = StateStopped
+    s.mu.Unlock()
+}
+
+// CaptureSource возвращает устройство и разрешение захвата из конфига потока.
+func (s *Streamer) CaptureSource() (device, resolution string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.config.Device, s.config.Resolution
+}
+
+// Wanted сообщает, запрошен ли поток: он может работать, перезапускаться или ждать устройство.
+func (s *Streamer) Wanted() bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.wanted
+}
+
+// Running сообщает, жив ли процесс пайплайна.
+func (s *Streamer) Running() bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.cmd != nil
+}
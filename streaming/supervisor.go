@@ -0,0 +1,284 @@
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StateStopped    = "stopped"
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateFailed     = "failed"
+)
+
+// События супервизора для Streamer.OnEvent.
+const (
+	EventCrashed   = "stream_crashed"
+	EventRestarted = "stream_restarted"
+	EventFailed    = "stream_failed"
+)
+
+const stderrTailLimit = 16 * 1024
+
+// PipelineStats - история падений пайплайна с момента запуска агента.
+type PipelineStats struct {
+	CrashCount   int       `json:"crash_count"`
+	LastExitCode int       `json:"last_exit_code"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastCrashAt  time.Time `json:"last_crash_at,omitempty"`
+	StderrTail   string    `json:"stderr_tail,omitempty"`
+}
+
+// wait ждет завершения процесса и решает, перезапускать ли пайплайн.
+func (s *Streamer) wait(cmd *exec.Cmd, done chan struct{}, stderr *tailBuffer, metrics *metricsCollector) {
+	err := cmd.Wait()
+	metrics.flush()
+	s.overlay.Stop()
+
+	s.mu.Lock()
+	if s.cmd == cmd {
+		s.cmd = nil
+		if s.stableTimer != nil {
+			s.stableTimer.Stop()
+			s.stableTimer = nil
+		}
+	}
+	expected := s.stopping || !s.wanted
+	close(done)
+
+	if expected {
+		s.mu.Unlock()
+		return
+	}
+
+	// выдернутый донгл - не сбой пайплайна: ждем устройство, не расходуя перезапуски
+	if s.watchesSource() {
+		if _, ok := resolveSource(s.identity); !ok || s.sourceLost {
+			data := s.enterWaiting()
+			s.mu.Unlock()
+			s.notify(EventSourceLost, data)
+			return
+		}
+	}
+
+	event, data := s.handleCrash(err, stderr.String())
+	s.mu.Unlock()
+
+	s.notify(EventCrashed, data)
+	if event == EventFailed {
+		s.notify(EventFailed, data)
+	}
+}
+
+// handleCrash обновляет статистику и планирует перезапуск. Вызывается под mu.
+func (s *Streamer) handleCrash(err error, stderr string) (string, map[string]interface{}) {
+	uptime := time.Since(s.startedAt)
+
+	s.stats.CrashCount++
+	s.stats.LastExitCode = exitCode(err)
+	s.stats.LastError = describeExit(err, stderr)
+	s.stats.LastCrashAt = time.Now().UTC()
+	s.stats.StderrTail = stderr
+
+	log.Printf("Pipeline exited unexpectedly after %s: %s", uptime.Round(time.Second), s.stats.LastError)
+
+	cfg := s.config.Restart
+	// пайплайн, проработавший дольше stable_sec, считается здоровым - счетчик сбрасывается
+	if cfg.StableSec > 0 && uptime >= time.Duration(cfg.StableSec)*time.Second {
+		s.restarts = 0
+	}
+
+	data := map[string]interface{}{
+		"exit_code":   s.stats.LastExitCode,
+		"error":       s.stats.LastError,
+		"crash_count": s.stats.CrashCount,
+		"restarts":    s.restarts,
+		"uptime_sec":  int(uptime.Seconds()),
+		"stderr":      lastBytes(stderr, 2048),
+	}
+	if s.rejectDecoder(uptime, stderr) {
+		data["decoder_rejected"] = s.decoder.Name
+	}
+
+	if s.restarts >= cfg.MaxRestarts {
+		log.Printf("Stream restart limit (%d) reached, giving up", cfg.MaxRestarts)
+		s.state = StateFailed
+		s.wanted = false
+		return EventFailed, data
+	}
+
+	delay := restartDelay(cfg.BackoffSec, cfg.MaxBackoffSec, s.restarts)
+	data["restart_in_sec"] = delay.Seconds()
+	log.Printf("Restarting stream in %s (attempt %d of %d)", delay, s.restarts+1, cfg.MaxRestarts)
+
+	s.state = StateRestarting
+	s.restartTimer = time.AfterFunc(delay, s.restart)
+	return EventCrashed, data
+}
+
+func (s *Streamer) restart() {
+	s.mu.Lock()
+	if !s.wanted || s.cmd != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.restartTimer = nil
+
+	if s.watchesSource() {
+		path, ok := resolveSource(s.identity)
+		if !ok {
+			data := s.enterWaiting()
+			s.mu.Unlock()
+			s.notify(EventSourceLost, data)
+			return
+		}
+		s.source = path
+	}
+
+	s.restarts++
+	attempt := s.restarts
+
+	if err := s.launch(); err != nil {
+		// процесс даже не стартовал - это такое же падение, как и выход
+		event, data := s.handleCrash(err, "")
+		s.mu.Unlock()
+		s.notify(EventCrashed, data)
+		if event == EventFailed {
+			s.notify(EventFailed, data)
+		}
+		return
+	}
+	s.mu.Unlock()
+
+	log.Printf("Stream restarted (attempt %d)", attempt)
+	s.notify(EventRestarted, map[string]interface{}{"restarts": attempt})
+}
+
+func (s *Streamer) notify(event string, data map[string]interface{}) {
+	if s.OnEvent != nil {
+		s.OnEvent(event, data)
+	}
+}
+
+// State возвращает состояние пайплайна: stopped, running, restarting, failed
+// или waiting_for_source.
+func (s *Streamer) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state
+}
+
+// Status - состояние супервизора для API статуса.
+func (s *Streamer) Status() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := map[string]interface{}{
+		"state":    s.state,
+		"backend":  s.config.Backend,
+		"decoder":  s.decoder.Name,
+		"source":   s.source,
+		"restarts": s.restarts,
+		"crashes":  s.stats,
+	}
+	if s.usesDecoder() {
+		status["decoders_available"] = decoderNames(s.available)
+		if s.decoder.Name == "" {
+			status["decoder"] = s.plannedDecoder()
+		}
+	}
+	if s.identity != s.source {
+		status["source_id"] = s.identity
+	}
+	if s.cmd != nil {
+		status["capture"] = s.mode
+		status["frame_tap"] = s.tap.Active
+		status["uptime_sec"] = int(time.Since(s.startedAt).Seconds())
+		status["metrics"] = s.metricsLocked()
+	}
+	return status
+}
+
+// restartDelay - экспоненциальная задержка перед перезапуском: base, 2*base, 4*base... до max.
+func restartDelay(baseSec, maxSec, attempt int) time.Duration {
+	if baseSec <= 0 {
+		baseSec = 1
+	}
+	d := time.Duration(baseSec) * time.Second << uint(attempt)
+	limit := time.Duration(maxSec) * time.Second
+	if limit > 0 && (d > limit || d <= 0) {
+		d = limit
+	}
+	return d
+}
+
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// describeExit дополняет ошибку процесса последней строкой stderr, где gst-launch
+// и ffmpeg обычно пишут причину ("ERROR: from element ...").
+func describeExit(err error, stderr string) string {
+	msg := "pipeline exited"
+	if err != nil {
+		msg = err.Error()
+	}
+
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return fmt.Sprintf("%s: %s", msg, line)
+		}
+	}
+	return msg
+}
+
+func lastBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// tailBuffer хранит только последние limit байт вывода процесса.
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: limit}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.limit:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return string(t.buf)
+}
@@ -0,0 +1,79 @@
+package streaming
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TapInfo - отвод сырых кадров работающего пайплайна в shmsink. Снимки, превью
+// и запись читают кадры отдельными процессами через shmsrc, не трогая вывод на экран.
+type TapInfo struct {
+	SocketPath string `json:"socket_path"`
+	Caps       string `json:"caps,omitempty"`
+	Active     bool   `json:"active"` // бэкенд встроил отвод в пайплайн
+}
+
+const tapFormat = "I420"
+
+func tapSocketPath(tempDir string) string {
+	return filepath.Join(tempDir, "frames.sock")
+}
+
+// tapTee вставляется в основную ветку после плашки, tapBranch - отдельным звеном
+// описания. Очередь с leaky не дает медленному читателю тормозить экран.
+func tapTee(socketPath string) string {
+	if socketPath == "" {
+		return ""
+	}
+	return "! tee name=tap"
+}
+
+func tapBranch(socketPath string) string {
+	if socketPath == "" {
+		return ""
+	}
+	return fmt.Sprintf("tap. ! queue max-size-buffers=2 leaky=downstream ! videoconvert "+
+		"! video/x-raw,format=%s ! shmsink socket-path=%s wait-for-connection=false sync=false",
+		tapFormat, socketPath)
+}
+
+// tapCaps - caps кадров в сокете; shmsrc их не передает, читатель задает их сам.
+func tapCaps(mode CaptureMode) string {
+	framerate := mode.Framerate
+	if framerate == "" {
+		framerate = "0/1"
+	}
+	return fmt.Sprintf("video/x-raw,format=%s,width=%d,height=%d,framerate=%s", tapFormat, mode.Width, mode.Height, framerate)
+}
+
+// TapSource - начало пайплайна читателя отвода; props - дополнительные свойства shmsrc.
+func TapSource(t TapInfo, props ...string) []string {
+	args := []string{"shmsrc", fmt.Sprintf("socket-path=%s", t.SocketPath), "is-live=true", "do-timestamp=true"}
+	args = append(args, props...)
+	return append(args, "!", t.Caps)
+}
+
+// prepareTap удаляет сокет, оставшийся от упавшего процесса: shmsink не создаст
+// новый поверх существующего.
+func prepareTap(socketPath string) error {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Tap возвращает отвод кадров работающего пайплайна; ok=false, если пайплайн
+// не запущен, останавливается или его шаблон не поддерживает отвод.
+func (s *Streamer) Tap() (TapInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd == nil || s.stopping || !s.tap.Active {
+		return TapInfo{}, false
+	}
+	return s.tap, true
+}
@@ -0,0 +1,222 @@
+package streaming
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"rentiga-device/models"
+)
+
+// DefaultTemplate - MJPEG с автоматически выбранным декодером (см. decoder.go).
+const DefaultTemplate = "mjpeg"
+
+// Встроенные шаблоны пайплайна для gst-launch-1.0 под разные ревизии железа.
+// Шаблон должен содержать {{.Overlay}} там, где кадр смешивается с плашкой,
+// и {{.OverlaySource}} в конце описания - вторую ветку compositor.
+// {{caps "image/jpeg"}} дописывает к caps режим, согласованный с устройством.
+// {{.Transform}} - обрезка, поворот и масштаб из stream.transform, до плашки.
+// {{.Tap}} и {{.TapBranch}} - отвод кадров для снимков и превью (см. tap.go).
+// fpsdisplaysink с name=stats дает статистику кадров (см. stats.go); sync задается
+// на нем самом - он переносит значение на вложенный синк.
+var builtinTemplates = map[string]string{
+	"mjpeg": `v4l2src device={{.Device}} ! {{or .Caps (caps "image/jpeg")}} ! {{.Decoder}}
+		{{.Transform}} {{.Overlay}} {{.Tap}} ! queue max-size-buffers={{var "queue_size" "3"}} leaky=downstream
+		! fpsdisplaysink name=stats text-overlay=false fps-update-interval=1000 sync=false
+		video-sink="kmssink connector-id={{.Connector}} sync=false force-modesetting=true show-preroll-frame=false"
+		{{.TapBranch}}
+		{{.OverlaySource}}`,
+
+	"vaapi-mjpeg": `v4l2src device={{.Device}} ! {{or .Caps (caps "image/jpeg")}} ! jpegparse ! vaapijpegdec
+		{{.Transform}} {{.Overlay}} {{.Tap}} ! queue max-size-buffers={{var "queue_size" "3"}} leaky=downstream
+		! fpsdisplaysink name=stats text-overlay=false fps-update-interval=1000 sync=false
+		video-sink="kmssink connector-id={{.Connector}} sync=false force-modesetting=true show-preroll-frame=false"
+		{{.TapBranch}}
+		{{.OverlaySource}}`,
+
+	"v4l2-mjpeg": `v4l2src device={{.Device}} ! {{or .Caps (caps "image/jpeg")}} ! jpegparse ! v4l2jpegdec ! videoconvert
+		{{.Transform}} {{.Overlay}} {{.Tap}} ! queue max-size-buffers={{var "queue_size" "3"}} leaky=downstream
+		! fpsdisplaysink name=stats text-overlay=false fps-update-interval=1000 sync=false
+		video-sink="kmssink connector-id={{.Connector}} sync=false force-modesetting=true show-preroll-frame=false"
+		{{.TapBranch}}
+		{{.OverlaySource}}`,
+
+	"jpegdec-mjpeg": `v4l2src device={{.Device}} ! {{or .Caps (caps "image/jpeg")}} ! jpegparse ! jpegdec ! videoconvert
+		{{.Transform}} {{.Overlay}} {{.Tap}} ! queue max-size-buffers={{var "queue_size" "3"}} leaky=downstream
+		! fpsdisplaysink name=stats text-overlay=false fps-update-interval=1000 sync=false
+		video-sink="kmssink connector-id={{.Connector}} sync=false force-modesetting=true show-preroll-frame=false"
+		{{.TapBranch}}
+		{{.OverlaySource}}`,
+
+	"raw-yuyv": `v4l2src device={{.Device}}
+		! {{or .Caps (caps "video/x-raw,format=YUY2")}} ! videoconvert
+		{{.Transform}} {{.Overlay}} {{.Tap}} ! queue max-size-buffers={{var "queue_size" "3"}} leaky=downstream
+		! fpsdisplaysink name=stats text-overlay=false fps-update-interval=1000 sync=false
+		video-sink="kmssink connector-id={{.Connector}} sync=false force-modesetting=true show-preroll-frame=false"
+		{{.TapBranch}}
+		{{.OverlaySource}}`,
+}
+
+// TemplateVars - переменные, доступные в шаблоне пайплайна.
+type TemplateVars struct {
+	Device     string
+	Connector  string
+	Resolution string
+	Width      int
+	Height     int
+	Framerate  string // "30/1", пусто - как отдаст источник
+	Caps       string // caps источника из конфига, пусто - значение шаблона по умолчанию
+	Decoder    string // цепочка декодирования MJPEG, выбранная Streamer
+
+	// обрезка, поворот и масштаб, пусто если stream.transform не задан
+	Transform string
+
+	// фрагменты плашки, пустые если она выключена
+	Overlay       string
+	OverlaySource string
+
+	// фрагменты отвода кадров, пустые если stream.frame_tap выключен
+	Tap       string
+	TapBranch string
+
+	Vars map[string]string // stream.variables
+
+	// negotiate согласует режим с устройством для {{caps}}; nil - размер и частота из конфига
+	negotiate func(media string) (string, error)
+}
+
+// Templates - имена встроенных шаблонов.
+func Templates() []string {
+	names := make([]string, 0, len(builtinTemplates))
+	for name := range builtinTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupTemplate ищет шаблон сначала в stream.templates, потом среди встроенных,
+// так что встроенный шаблон можно переопределить под тем же именем.
+func lookupTemplate(cfg *models.StreamConfig) (string, string, error) {
+	name := cfg.Template
+	if name == "" {
+		name = DefaultTemplate
+	}
+	if text, ok := cfg.Templates[name]; ok {
+		return name, text, nil
+	}
+	if text, ok := builtinTemplates[name]; ok {
+		return name, text, nil
+	}
+	return "", "", fmt.Errorf("unknown pipeline template %q (built-in: %v)", name, Templates())
+}
+
+// TemplateUsesDecoder сообщает, выбирает ли шаблон декодер через {{.Decoder}};
+// шаблоны с жестко заданным декодером автоматический выбор не используют.
+func TemplateUsesDecoder(cfg *models.StreamConfig) bool {
+	_, text, err := lookupTemplate(cfg)
+	return err == nil && strings.Contains(text, ".Decoder")
+}
+
+// TemplateUsesTap сообщает, поддерживает ли шаблон отвод кадров.
+func TemplateUsesTap(cfg *models.StreamConfig) bool {
+	_, text, err := lookupTemplate(cfg)
+	return err == nil && strings.Contains(text, ".TapBranch")
+}
+
+// RenderTemplate подставляет переменные в выбранный шаблон и возвращает
+// аргументы gst-launch-1.0.
+func RenderTemplate(cfg *models.StreamConfig, vars TemplateVars) ([]string, error) {
+	name, text, err := lookupTemplate(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		// var "name" "default" - значение из stream.variables или значение по умолчанию
+		"var": func(key, def string) string {
+			if v, ok := vars.Vars[key]; ok {
+				return v
+			}
+			return def
+		},
+		"caps": func(media string) (string, error) {
+			if vars.negotiate != nil {
+				return vars.negotiate(media)
+			}
+			return modeCaps(media, CaptureMode{Width: vars.Width, Height: vars.Height, Framerate: vars.Framerate}), nil
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return nil, fmt.Errorf("template %q: %v", name, err)
+	}
+
+	args := strings.Fields(buf.String())
+	if err := checkDescription(args); err != nil {
+		return nil, fmt.Errorf("template %q: %v", name, err)
+	}
+	if strings.Contains(text, ".TapBranch") && !strings.Contains(text, ".Tap}}") {
+		return nil, fmt.Errorf("template %q: {{.TapBranch}} requires {{.Tap}} in the main branch", name)
+	}
+	if vars.Transform != "" && !strings.Contains(text, ".Transform") {
+		return nil, fmt.Errorf("template %q: stream.transform is set but the template has no {{.Transform}}", name)
+	}
+	if vars.OverlaySource != "" && !strings.Contains(text, ".OverlaySource") {
+		return nil, fmt.Errorf("template %q: overlay is enabled but the template has no {{.OverlaySource}}", name)
+	}
+	return args, nil
+}
+
+// ValidateTemplate рендерит шаблон с тестовыми значениями, чтобы поймать ошибки
+// шаблона при загрузке конфига, а не при запуске пайплайна.
+func ValidateTemplate(cfg *models.StreamConfig) error {
+	vars := TemplateVars{
+		Device:     "/dev/video0",
+		Connector:  "0",
+		Resolution: "1920x1080",
+		Width:      1920,
+		Height:     1080,
+		Framerate:  cfg.Framerate,
+		Caps:       cfg.Caps,
+		Decoder:    decoders[0].Chain,
+		Transform:  strings.Join(gstTransform(cfg.Transform), " "),
+		Vars:       cfg.Variables,
+	}
+	if cfg.Overlay.Enabled {
+		vars.Overlay = strings.Join(gstOverlayMixer("overlay.png"), " ")
+		vars.OverlaySource = strings.Join(gstOverlaySource("overlay.png"), " ")
+	}
+	if cfg.FrameTap {
+		vars.Tap = tapTee("frames.sock")
+		vars.TapBranch = tapBranch("frames.sock")
+	}
+	_, err := RenderTemplate(cfg, vars)
+	return err
+}
+
+// checkDescription ловит типичные ошибки описания: пустые звенья "! !",
+// "!" в начале или конце и незакрытые кавычки.
+func checkDescription(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("rendered pipeline is empty")
+	}
+	if args[0] == "!" || args[len(args)-1] == "!" {
+		return fmt.Errorf("pipeline must not start or end with '!'")
+	}
+	for i := 1; i < len(args); i++ {
+		if args[i] == "!" && args[i-1] == "!" {
+			return fmt.Errorf("empty element between '!' links")
+		}
+	}
+	if strings.Count(strings.Join(args, " "), `"`)%2 != 0 {
+		return fmt.Errorf("unbalanced quotes")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package streaming
+
+import (
+	"fmt"
+	"strings"
+
+	"rentiga-device/models"
+)
+
+// testPipeline позволяет запускать агент без карты захвата и дисплея (ноутбук, CI):
+// videotestsrc вместо камеры и fakesink (или файл из StreamConfig.TestOutput) вместо экрана.
+type testPipeline struct{}
+
+func (testPipeline) Name() string { return BackendTest }
+
+func (testPipeline) StreamCommand(p PipelineParams) (string, []string, error) {
+	framerate := p.Config.Framerate
+	if framerate == "" {
+		framerate = "30/1"
+	}
+	if p.Mode != nil {
+		p.Mode.Framerate = framerate
+	}
+	args := []string{
+		"-v",
+		"videotestsrc", "is-live=true", "pattern=smpte",
+		"!", fmt.Sprintf("video/x-raw,width=%d,height=%d,framerate=%s", p.Width, p.Height, framerate),
+	}
+	args = append(args, gstTransform(p.Config.Transform)...)
+	args = append(args, gstOverlayMixer(p.OverlayPath)...)
+	if p.Tap != nil {
+		args = append(args, strings.Fields(tapTee(p.Tap.SocketPath))...)
+	}
+	args = append(args, testSink(p.Config)...)
+	if p.Tap != nil {
+		args = append(args, strings.Fields(tapBranch(p.Tap.SocketPath))...)
+		p.Tap.Active = true
+	}
+	args = append(args, gstOverlaySource(p.OverlayPath)...)
+	return "gst-launch-1.0", args, nil
+}
+
+func (testPipeline) ImageCommand(cfg *models.StreamConfig, imagePath string) (string, []string, error) {
+	args := gstImageSource(imagePath)
+	args = append(args, "!", "fakesink", "sync=true")
+	return "gst-launch-1.0", args, nil
+}
+
+// testSink пишет поток в Matroska, если задан TestOutput: этот формат читается
+// и без корректного завершения файла, что важно при остановке через SIGINT.
+func testSink(cfg *models.StreamConfig) []string {
+	if cfg.TestOutput == "" {
+		return []string{"!", "fpsdisplaysink", "name=" + statsElement, "text-overlay=false",
+			"fps-update-interval=1000", "sync=true", "video-sink=fakesink"}
+	}
+	if !strings.HasSuffix(cfg.TestOutput, ".mkv") {
+		return []string{"!", "videoconvert", "!", "jpegenc", "!", "multifilesink",
+			fmt.Sprintf("location=%s", cfg.TestOutput), "max-files=1"}
+	}
+	return []string{
+		"!", "videoconvert",
+		"!", "x264enc", "tune=zerolatency", "speed-preset=ultrafast",
+		"!", "matroskamux", "streamable=true",
+		"!", "filesink", fmt.Sprintf("location=%s", cfg.TestOutput),
+	}
+}
@@ -0,0 +1,164 @@
+package streaming
+
+import (
+	"fmt"
+	"strings"
+
+	"rentiga-device/models"
+)
+
+const (
+	ScaleNone    = ""
+	ScaleFit     = "fit"     // с сохранением пропорций, свободное место - черные поля
+	ScaleStretch = "stretch" // растянуть на весь размер без учета пропорций
+)
+
+// orientation - поворот и отражения как матрица (x, y) -> (a*x + b*y, c*x + d*y)
+// в экранных координатах (y вниз). Поворот и отражения сводятся к одному videoflip.
+type orientation struct{ a, b, c, d int }
+
+var (
+	orientIdentity = orientation{1, 0, 0, 1}
+	orientRotate   = map[int]orientation{
+		0:   orientIdentity,
+		90:  {0, -1, 1, 0},
+		180: {-1, 0, 0, -1},
+		270: {0, 1, -1, 0},
+	}
+	orientFlipH = orientation{-1, 0, 0, 1}
+	orientFlipV = orientation{1, 0, 0, -1}
+)
+
+// методы videoflip (и их аналоги в фильтрах ffmpeg)
+var videoflipMethods = map[orientation]string{
+	orientIdentity: "none",
+	{0, -1, 1, 0}:  "clockwise",
+	{-1, 0, 0, -1}: "rotate-180",
+	{0, 1, -1, 0}:  "counterclockwise",
+	orientFlipH:    "horizontal-flip",
+	orientFlipV:    "vertical-flip",
+	{0, 1, 1, 0}:   "upper-left-diagonal",
+	{0, -1, -1, 0}: "upper-right-diagonal",
+}
+
+var ffmpegFlipFilters = map[string]string{
+	"clockwise":            "transpose=clock",
+	"rotate-180":           "hflip,vflip",
+	"counterclockwise":     "transpose=cclock",
+	"horizontal-flip":      "hflip",
+	"vertical-flip":        "vflip",
+	"upper-left-diagonal":  "transpose=cclock_flip",
+	"upper-right-diagonal": "transpose=clock_flip",
+}
+
+// then - сначала o, затем p.
+func (o orientation) then(p orientation) orientation {
+	return orientation{
+		p.a*o.a + p.b*o.c, p.a*o.b + p.b*o.d,
+		p.c*o.a + p.d*o.c, p.c*o.b + p.d*o.d,
+	}
+}
+
+// swapsAxes - поворот на 90/270 или отражение по диагонали меняют ширину и высоту местами.
+func (o orientation) swapsAxes() bool {
+	return o.a == 0
+}
+
+// orient - поворот, затем отражения.
+func orient(t models.TransformConfig) orientation {
+	o := orientRotate[t.Rotate]
+	if t.FlipHorizontal {
+		o = o.then(orientFlipH)
+	}
+	if t.FlipVertical {
+		o = o.then(orientFlipV)
+	}
+	return o
+}
+
+// flipMethod - все преобразование ориентации одним методом videoflip.
+func flipMethod(t models.TransformConfig) string {
+	return videoflipMethods[orient(t)]
+}
+
+// TransformSize - размер кадра после обрезки, поворота и масштабирования; под него
+// рисуется плашка и описываются caps отвода кадров.
+func TransformSize(t models.TransformConfig, width, height int) (int, int, error) {
+	c := t.Crop
+	width -= c.Left + c.Right
+	height -= c.Top + c.Bottom
+	if width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("crop %+v leaves no picture", c)
+	}
+	if orient(t).swapsAxes() {
+		width, height = height, width
+	}
+	if t.Scale != ScaleNone {
+		width, height = t.Width, t.Height
+	}
+	return width, height, nil
+}
+
+// gstTransform - звенья videocrop, videoflip и videoscale; пусто, если преобразований нет.
+func gstTransform(t models.TransformConfig) []string {
+	var args []string
+	if c := t.Crop; c != (models.CropConfig{}) {
+		args = append(args, "!", "videocrop",
+			fmt.Sprintf("left=%d", c.Left), fmt.Sprintf("right=%d", c.Right),
+			fmt.Sprintf("top=%d", c.Top), fmt.Sprintf("bottom=%d", c.Bottom))
+	}
+	if method := flipMethod(t); method != "none" {
+		args = append(args, "!", "videoflip", fmt.Sprintf("method=%s", method))
+	}
+	if t.Scale != ScaleNone {
+		args = append(args,
+			"!", "videoscale", fmt.Sprintf("add-borders=%t", t.Scale == ScaleFit),
+			"!", fmt.Sprintf("video/x-raw,width=%d,height=%d,pixel-aspect-ratio=1/1", t.Width, t.Height))
+	}
+	return args
+}
+
+// ffmpegTransform - то же для -vf/-filter_complex ffmpeg; пусто, если преобразований нет.
+func ffmpegTransform(t models.TransformConfig) string {
+	var filters []string
+	if c := t.Crop; c != (models.CropConfig{}) {
+		filters = append(filters, fmt.Sprintf("crop=iw-%d:ih-%d:%d:%d", c.Left+c.Right, c.Top+c.Bottom, c.Left, c.Top))
+	}
+	if f, ok := ffmpegFlipFilters[flipMethod(t)]; ok {
+		filters = append(filters, f)
+	}
+	switch t.Scale {
+	case ScaleFit:
+		filters = append(filters,
+			fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", t.Width, t.Height),
+			fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", t.Width, t.Height),
+			"setsar=1")
+	case ScaleStretch:
+		filters = append(filters, fmt.Sprintf("scale=%d:%d", t.Width, t.Height), "setsar=1")
+	}
+	return strings.Join(filters, ",")
+}
+
+// ValidateTransform проверяет настройки преобразования кадра.
+func ValidateTransform(t models.TransformConfig) error {
+	var problems []string
+	if _, ok := orientRotate[t.Rotate]; !ok {
+		problems = append(problems, fmt.Sprintf("rotate must be 0, 90, 180 or 270, got %d", t.Rotate))
+	}
+	if c := t.Crop; c.Left < 0 || c.Right < 0 || c.Top < 0 || c.Bottom < 0 {
+		problems = append(problems, "crop values must not be negative")
+	}
+	switch t.Scale {
+	case ScaleNone:
+	case ScaleFit, ScaleStretch:
+		if t.Width <= 0 || t.Height <= 0 || t.Width%2 != 0 || t.Height%2 != 0 {
+			problems = append(problems, "width and height must be positive even numbers when scale is set")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("scale must be empty, fit or stretch, got %q", t.Scale))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
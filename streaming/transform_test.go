@@ -0,0 +1,65 @@
+package streaming
+
+import (
+	"fmt"
+	"testing"
+
+	"rentiga-device/models"
+)
+
+func TestTransformOrientation(t *testing.T) {
+	// videoflip для каждого поворота и отражений: без отражений, H, V, H+V
+	want := map[int][4]string{
+		0:   {"none", "horizontal-flip", "vertical-flip", "rotate-180"},
+		90:  {"clockwise", "upper-left-diagonal", "upper-right-diagonal", "counterclockwise"},
+		180: {"rotate-180", "vertical-flip", "horizontal-flip", "none"},
+		270: {"counterclockwise", "upper-right-diagonal", "upper-left-diagonal", "clockwise"},
+	}
+
+	for rotate, methods := range want {
+		for i, method := range methods {
+			tr := models.TransformConfig{Rotate: rotate, FlipHorizontal: i&1 != 0, FlipVertical: i&2 != 0}
+			t.Run(fmt.Sprintf("rotate=%d,h=%t,v=%t", rotate, tr.FlipHorizontal, tr.FlipVertical), func(t *testing.T) {
+				if got := flipMethod(tr); got != method {
+					t.Errorf("flipMethod() = %q, want %q", got, method)
+				}
+
+				w, h, err := TransformSize(tr, 640, 480)
+				if err != nil {
+					t.Fatalf("TransformSize() error: %v", err)
+				}
+				wantW, wantH := 640, 480
+				if rotate == 90 || rotate == 270 {
+					wantW, wantH = 480, 640
+				}
+				if w != wantW || h != wantH {
+					t.Errorf("TransformSize() = %dx%d, want %dx%d", w, h, wantW, wantH)
+				}
+			})
+		}
+	}
+}
+
+func TestTransformSizeCropAndScale(t *testing.T) {
+	tests := []struct {
+		name    string
+		tr      models.TransformConfig
+		w, h    int
+		wantErr bool
+	}{
+		{"crop", models.TransformConfig{Crop: models.CropConfig{Left: 10, Right: 30, Top: 20}}, 600, 460, false},
+		{"crop then rotate", models.TransformConfig{Rotate: 90, Crop: models.CropConfig{Left: 40}}, 480, 600, false},
+		{"scale overrides size", models.TransformConfig{Rotate: 90, Scale: ScaleFit, Width: 1280, Height: 720}, 1280, 720, false},
+		{"crop leaves no width", models.TransformConfig{Crop: models.CropConfig{Left: 320, Right: 320}}, 0, 0, true},
+		{"crop leaves no height", models.TransformConfig{Crop: models.CropConfig{Top: 500}}, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, err := TransformSize(tt.tr, 640, 480)
+			if (err != nil) != tt.wantErr || w != tt.w || h != tt.h {
+				t.Errorf("TransformSize() = %d, %d, %v; want %d, %d, err=%v", w, h, err, tt.w, tt.h, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package streaming
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl-коды и константы из linux/videodev2.h
+const (
+	vidiocQueryCap           = 0x80685600
+	vidiocEnumFmt            = 0xc0405602
+	vidiocEnumFrameSizes     = 0xc02c564a
+	vidiocEnumFrameIntervals = 0xc034564b
+
+	v4l2BufTypeVideoCapture = 1
+
+	v4l2CapVideoCapture = 0x00000001
+	v4l2CapStreaming    = 0x04000000
+	v4l2CapDeviceCaps   = 0x80000000
+
+	v4l2FrmSizeTypeDiscrete = 1
+	v4l2FrmIvalTypeDiscrete = 1
+)
+
+type v4l2Capability struct {
+	Driver       [16]byte
+	Card         [32]byte
+	BusInfo      [32]byte
+	Version      uint32
+	Capabilities uint32
+	DeviceCaps   uint32
+	Reserved     [3]uint32
+}
+
+type v4l2FmtDesc struct {
+	Index       uint32
+	Type        uint32
+	Flags       uint32
+	Description [32]byte
+	PixelFormat uint32
+	MbusCode    uint32
+	Reserved    [3]uint32
+}
+
+type v4l2FrmSizeEnum struct {
+	Index       uint32
+	PixelFormat uint32
+	Type        uint32
+	// discrete: width, height; stepwise: min_w, max_w, step_w, min_h, max_h, step_h
+	Size     [6]uint32
+	Reserved [2]uint32
+}
+
+type v4l2FrmIvalEnum struct {
+	Index       uint32
+	PixelFormat uint32
+	Width       uint32
+	Height      uint32
+	Type        uint32
+	// discrete: numerator, denominator; stepwise: min, max, step
+	Interval [6]uint32
+	Reserved [2]uint32
+}
+
+// VideoDevice - устройство захвата и его поддерживаемые режимы.
+type VideoDevice struct {
+	Path    string        `json:"path"`
+	ByID    string        `json:"by_id,omitempty"`
+	Driver  string        `json:"driver"`
+	Card    string        `json:"card"`
+	BusInfo string        `json:"bus_info"`
+	Formats []VideoFormat `json:"formats"`
+}
+
+type VideoFormat struct {
+	FourCC      string      `json:"fourcc"`
+	Description string      `json:"description"`
+	Sizes       []VideoSize `json:"sizes"`
+}
+
+// VideoSize - дискретный размер кадра или диапазон (Stepwise) с шагом.
+type VideoSize struct {
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Framerates []string `json:"framerates,omitempty"` // "30/1", по убыванию
+
+	Stepwise  bool `json:"stepwise,omitempty"`
+	MinWidth  int  `json:"min_width,omitempty"`
+	MinHeight int  `json:"min_height,omitempty"`
+	StepW     int  `json:"step_width,omitempty"`
+	StepH     int  `json:"step_height,omitempty"`
+}
+
+// ListVideoDevices перечисляет /dev/video* с возможностью захвата.
+// Метаданные и выходные узлы того же драйвера пропускаются.
+func ListVideoDevices() ([]VideoDevice, error) {
+	paths, err := filepath.Glob("/dev/video*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	devices := []VideoDevice{}
+	for _, path := range paths {
+		dev, err := ProbeVideoDevice(path)
+		if err != nil {
+			continue
+		}
+		devices = append(devices, *dev)
+	}
+	return devices, nil
+}
+
+// ProbeVideoDevice запрашивает у драйвера возможности устройства и все режимы захвата.
+func ProbeVideoDevice(path string) (*VideoDevice, error) {
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer syscall.Close(fd)
+
+	var vcap v4l2Capability
+	if err := ioctl(fd, vidiocQueryCap, unsafe.Pointer(&vcap)); err != nil {
+		return nil, fmt.Errorf("%s is not a V4L2 device: %v", path, err)
+	}
+	caps := vcap.Capabilities
+	if caps&v4l2CapDeviceCaps != 0 {
+		caps = vcap.DeviceCaps
+	}
+	if caps&v4l2CapVideoCapture == 0 || caps&v4l2CapStreaming == 0 {
+		return nil, fmt.Errorf("%s is not a capture device", path)
+	}
+
+	dev := &VideoDevice{
+		Path:    path,
+		Driver:  cString(vcap.Driver[:]),
+		Card:    cString(vcap.Card[:]),
+		BusInfo: cString(vcap.BusInfo[:]),
+		Formats: []VideoFormat{},
+	}
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		dev.ByID = videoByID()[target]
+	}
+
+	for i := uint32(0); ; i++ {
+		desc := v4l2FmtDesc{Index: i, Type: v4l2BufTypeVideoCapture}
+		if ioctl(fd, vidiocEnumFmt, unsafe.Pointer(&desc)) != nil {
+			break
+		}
+		dev.Formats = append(dev.Formats, VideoFormat{
+			FourCC:      fourCC(desc.PixelFormat),
+			Description: cString(desc.Description[:]),
+			Sizes:       enumSizes(fd, desc.PixelFormat),
+		})
+	}
+	return dev, nil
+}
+
+func enumSizes(fd int, pixfmt uint32) []VideoSize {
+	var sizes []VideoSize
+	for i := uint32(0); ; i++ {
+		fs := v4l2FrmSizeEnum{Index: i, PixelFormat: pixfmt}
+		if ioctl(fd, vidiocEnumFrameSizes, unsafe.Pointer(&fs)) != nil {
+			break
+		}
+		if fs.Type == v4l2FrmSizeTypeDiscrete {
+			w, h := fs.Size[0], fs.Size[1]
+			sizes = append(sizes, VideoSize{
+				Width:      int(w),
+				Height:     int(h),
+				Framerates: enumFramerates(fd, pixfmt, w, h),
+			})
+			continue
+		}
+		// continuous/stepwise - один диапазон, перечислять дальше нечего
+		sizes = append(sizes, VideoSize{
+			Stepwise:   true,
+			MinWidth:   int(fs.Size[0]),
+			Width:      int(fs.Size[1]),
+			StepW:      int(fs.Size[2]),
+			MinHeight:  int(fs.Size[3]),
+			Height:     int(fs.Size[4]),
+			StepH:      int(fs.Size[5]),
+			Framerates: enumFramerates(fd, pixfmt, fs.Size[1], fs.Size[4]),
+		})
+		break
+	}
+	return sizes
+}
+
+// enumFramerates возвращает частоты кадров в виде дробей GStreamer ("30/1"),
+// от большей к меньшей. V4L2 описывает интервал между кадрами, т.е. обратную величину.
+func enumFramerates(fd int, pixfmt, width, height uint32) []string {
+	type rate struct{ num, den uint32 }
+	var rates []rate
+	for i := uint32(0); ; i++ {
+		fi := v4l2FrmIvalEnum{Index: i, PixelFormat: pixfmt, Width: width, Height: height}
+		if ioctl(fd, vidiocEnumFrameIntervals, unsafe.Pointer(&fi)) != nil {
+			break
+		}
+		if fi.Type != v4l2FrmIvalTypeDiscrete {
+			// для диапазона берем самый короткий интервал - максимальную частоту
+			rates = append(rates, rate{fi.Interval[1], fi.Interval[0]})
+			break
+		}
+		if fi.Interval[0] == 0 {
+			continue
+		}
+		rates = append(rates, rate{fi.Interval[1], fi.Interval[0]})
+	}
+
+	sort.SliceStable(rates, func(i, j int) bool {
+		return uint64(rates[i].num)*uint64(rates[j].den) > uint64(rates[j].num)*uint64(rates[i].den)
+	})
+	result := make([]string, 0, len(rates))
+	for _, r := range rates {
+		result = append(result, fmt.Sprintf("%d/%d", r.num, r.den))
+	}
+	return result
+}
+
+// videoByID сопоставляет /dev/videoN стабильным именам из /dev/v4l/by-id.
+func videoByID() map[string]string {
+	return videoLinks("/dev/v4l/by-id")
+}
+
+// videoByPath - то же по /dev/v4l/by-path: имя привязано к порту USB, а не к
+// серийному номеру, зато есть и у донглов без серийника.
+func videoByPath() map[string]string {
+	return videoLinks("/dev/v4l/by-path")
+}
+
+func videoLinks(dir string) map[string]string {
+	result := make(map[string]string)
+	links, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for _, link := range links {
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		// у одного устройства бывает несколько ссылок (index0, index1) - берем первую
+		if _, ok := result[target]; !ok {
+			result[target] = link
+		}
+	}
+	return result
+}
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func fourCC(v uint32) string {
+	return strings.TrimRight(string([]byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)}), " \x00")
+}
@@ -2,27 +2,30 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/gotk3/gotk3/glib"
 
 	"rentiga-device/app"
+	"rentiga-device/models"
+	"rentiga-device/streaming"
 )
 
 type WebServer struct {
-    App      *app.App
-    Username string
-    Password string
+    App *app.App
 }
 
 func (ws *WebServer) Start(port string) {
     // Проверка наличия учетных данных
-    if ws.Username == "" || ws.Password == "" {
+    if auth := ws.App.WebAuth(); auth.Username == "" || auth.Password == "" {
         log.Fatal("Basic auth credentials not configured")
     }
 
@@ -36,6 +39,10 @@ func (ws *WebServer) Start(port string) {
     // Главный обработчик с цепочкой middleware
     mainHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         // Обработка API-запросов
+        if strings.HasPrefix(r.URL.Path, "/api/hls/") {
+            ws.handleHLS(w, r)
+            return
+        }
         if strings.HasPrefix(r.URL.Path, "/api/") {
             switch r.URL.Path {
             case "/api/status":
@@ -44,8 +51,34 @@ func (ws *WebServer) Start(port string) {
                 ws.handleStart(w, r)
             case "/api/stop":
                 ws.handleStop(w, r)
+            case "/api/streams":
+                ws.handleStreams(w, r)
 			case "/api/upload-cert":
 				ws.handleUploadCert(w, r)
+            case "/api/overlay":
+                ws.handleOverlay(w, r)
+            case "/api/audio":
+                ws.handleAudio(w, r)
+            case "/api/transform":
+                ws.handleTransform(w, r)
+            case "/api/devices":
+                ws.handleDevices(w, r)
+            case "/api/displays":
+                ws.handleDisplays(w, r)
+            case "/api/snapshot":
+                ws.handleSnapshot(w, r)
+            case "/api/preview":
+                ws.handlePreview(w, r)
+            case "/api/metrics":
+                ws.handleMetrics(w, r)
+            case "/api/network":
+                ws.handleNetwork(w, r)
+            case "/api/recording":
+                ws.handleRecording(w, r)
+            case "/api/recording/start":
+                ws.handleRecordingStart(w, r)
+            case "/api/recording/stop":
+                ws.handleRecordingStop(w, r)
             default:
                 http.NotFound(w, r)
             }
@@ -91,8 +124,10 @@ func (ws *WebServer) basicAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+        // Учетные данные читаются на каждый запрос, чтобы работала горячая перезагрузка конфига
+        auth := ws.App.WebAuth()
         user, pass, ok := r.BasicAuth()
-        if !ok || user != ws.Username || pass != ws.Password {
+        if !ok || user != auth.Username || pass != auth.Password {
             w.Header().Set("WWW-Authenticate", `Basic realm="Restricted", charset="UTF-8"`)
             http.Error(w, "Unauthorized", http.StatusUnauthorized)
             return
@@ -132,20 +167,348 @@ func (ws *WebServer) handleStatus(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, status)
 }
 
+// ?stream=<имя> запускает поток из streams, без него - основной
 func (ws *WebServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	name, ok := ws.streamParam(w, r)
+	if !ok {
+		return
+	}
 	glib.IdleAdd(func() {
-		ws.App.StartStream()
+		if err := ws.App.StartStreamByName(name); err != nil {
+			log.Printf("Stream start error: %v", err)
+		}
 	})
 	respondJSON(w, http.StatusOK, map[string]string{"status": "starting"})
 }
 
+// ?stream=<имя> останавливает поток из streams, без него - основной
 func (ws *WebServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	name, ok := ws.streamParam(w, r)
+	if !ok {
+		return
+	}
 	glib.IdleAdd(func() {
-		ws.App.StopStream()
+		ws.App.StopStreamByName(name)
 	})
 	respondJSON(w, http.StatusOK, map[string]string{"status": "stopping"})
 }
 
+// GET перечисляет потоки: основной и заданные в streams
+func (ws *WebServer) handleStreams(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, ws.App.StreamsStatus())
+}
+
+// streamParam возвращает ?stream=; на неизвестное имя отвечает 404.
+func (ws *WebServer) streamParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.URL.Query().Get("stream")
+	if !ws.App.HasStream(name) {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("unknown stream %q", name)})
+		return "", false
+	}
+	return name, true
+}
+
+// GET возвращает настройки плашки, POST меняет их: {"mode": "message", "message": "..."}
+func (ws *WebServer) handleOverlay(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, ws.App.OverlayConfig())
+	case http.MethodPost:
+		var update models.OverlayUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+		if err := ws.App.UpdateOverlay(update); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		respondJSON(w, http.StatusOK, ws.App.OverlayConfig())
+	default:
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// GET возвращает состояние звука, POST меняет его: {"volume": 0.8, "mute": false}
+func (ws *WebServer) handleAudio(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, ws.App.AudioStatus())
+	case http.MethodPost:
+		var update models.AudioUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+		if err := ws.App.UpdateAudio(update); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		respondJSON(w, http.StatusOK, ws.App.AudioStatus())
+	default:
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// GET возвращает преобразование кадра, POST заменяет его целиком и перезапускает поток;
+// ?stream=<имя> - для потока из streams
+func (ws *WebServer) handleTransform(w http.ResponseWriter, r *http.Request) {
+	name, ok := ws.streamParam(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		t, _ := ws.App.TransformConfig(name)
+		respondJSON(w, http.StatusOK, t)
+	case http.MethodPost:
+		var t models.TransformConfig
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+		if err := ws.App.SetTransform(name, t); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		t, _ = ws.App.TransformConfig(name)
+		respondJSON(w, http.StatusOK, t)
+	default:
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// GET возвращает устройства захвата с поддерживаемыми форматами, размерами и частотами
+func (ws *WebServer) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	devices, err := ws.App.VideoDevices()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, devices)
+}
+
+// GET возвращает DRM-коннекторы: имя, ID, состояние подключения и режимы
+func (ws *WebServer) handleDisplays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	displays, err := ws.App.Displays()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, displays)
+}
+
+// GET снимает кадр и отдает JPEG; ?upload=true дополнительно отправляет его на бэкенд,
+// ?stream=<имя> снимает поток из streams, ?file=<имя> отдает ранее сохраненный снимок
+func (ws *WebServer) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	if file := r.URL.Query().Get("file"); file != "" {
+		path, err := ws.App.SnapshotPath(file)
+		if err != nil {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		http.ServeFile(w, r, path)
+		return
+	}
+
+	name, ok := ws.streamParam(w, r)
+	if !ok {
+		return
+	}
+	upload := r.URL.Query().Get("upload") == "true"
+	info, err := ws.App.TakeSnapshot(name, upload)
+	if err != nil && info.File == "" {
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		// снимок есть, не удалась только отправка
+		w.Header().Set("X-Snapshot-Error", err.Error())
+	}
+
+	path, err := ws.App.SnapshotPath(info.File)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Snapshot-File", info.File)
+	w.Header().Set("X-Snapshot-Source", info.Source)
+	http.ServeFile(w, r, path)
+}
+
+// GET отдает multipart MJPEG; открывается прямо в <img src="/api/preview">
+func (ws *WebServer) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	pw := &previewWriter{w: w}
+	err := ws.App.ServePreview(r.Context(), pw)
+	if err != nil && !pw.started {
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, streaming.ErrPreviewBusy) {
+			status = http.StatusTooManyRequests
+		}
+		respondJSON(w, status, map[string]string{"error": err.Error()})
+	}
+}
+
+// previewWriter отправляет заголовки multipart с первым кадром, чтобы до него
+// можно было ответить ошибкой в JSON, и сбрасывает буфер после каждой записи.
+type previewWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (pw *previewWriter) Write(p []byte) (int, error) {
+	if !pw.started {
+		pw.started = true
+		h := pw.w.Header()
+		h.Set("Content-Type", "multipart/x-mixed-replace; boundary="+streaming.PreviewBoundary)
+		h.Set("Cache-Control", "no-cache, no-store")
+		h.Set("Connection", "close")
+		pw.w.WriteHeader(http.StatusOK)
+	}
+	n, err := pw.w.Write(p)
+	if f, ok := pw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// GET отдает показатели пайплайнов в текстовом формате Prometheus, с меткой stream
+func (ws *WebServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	type streamMetrics struct {
+		label string
+		m     streaming.PipelineMetrics
+	}
+	var running []streamMetrics
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintf(w, "# TYPE rentiga_pipeline_up gauge\n")
+	for _, name := range ws.App.StreamNames() {
+		label := fmt.Sprintf("stream=%q", name)
+		m, ok := ws.App.PipelineMetrics(name)
+		up := 0
+		if ok {
+			up = 1
+			running = append(running, streamMetrics{label, m})
+		}
+		fmt.Fprintf(w, "rentiga_pipeline_up{%s} %d\n", label, up)
+	}
+	if len(running) == 0 {
+		return
+	}
+
+	metric := func(name, kind string, value func(streaming.PipelineMetrics) interface{}) {
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+		for _, s := range running {
+			fmt.Fprintf(w, "%s{%s} %v\n", name, s.label, value(s.m))
+		}
+	}
+	metric("rentiga_pipeline_uptime_seconds", "gauge", func(m streaming.PipelineMetrics) interface{} { return m.UptimeSec })
+	metric("rentiga_pipeline_frames_rendered_total", "counter", func(m streaming.PipelineMetrics) interface{} { return m.FramesRendered })
+	metric("rentiga_pipeline_frames_dropped_total", "counter", func(m streaming.PipelineMetrics) interface{} { return m.FramesDropped })
+	metric("rentiga_pipeline_fps", "gauge", func(m streaming.PipelineMetrics) interface{} { return m.FPS })
+	metric("rentiga_pipeline_average_fps", "gauge", func(m streaming.PipelineMetrics) interface{} { return m.AverageFPS })
+
+	fmt.Fprintf(w, "# TYPE rentiga_pipeline_queue_dropped_total counter\n")
+	for _, s := range running {
+		queues := make([]string, 0, len(s.m.QueueDrops))
+		for q := range s.m.QueueDrops {
+			queues = append(queues, q)
+		}
+		sort.Strings(queues)
+		for _, q := range queues {
+			fmt.Fprintf(w, "rentiga_pipeline_queue_dropped_total{%s,queue=%q} %d\n", s.label, q, s.m.QueueDrops[q])
+		}
+	}
+	fmt.Fprintf(w, "# TYPE rentiga_pipeline_latency_ms gauge\n")
+	for _, s := range running {
+		if s.m.LatencyMs > 0 {
+			fmt.Fprintf(w, "rentiga_pipeline_latency_ms{%s} %g\n", s.label, s.m.LatencyMs)
+		}
+	}
+}
+
+// GET возвращает состояние сетевого вывода (HLS или RTSP)
+func (ws *WebServer) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, ws.App.NetworkStatus())
+}
+
+// GET /api/hls/index.m3u8 и сегменты; плеер бэкенда ходит с теми же учетными данными
+func (ws *WebServer) handleHLS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/hls/")
+	path, err := ws.App.HLSFile(name)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	if name == streaming.HLSPlaylist {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "video/mp2t")
+	}
+	http.ServeFile(w, r, path)
+}
+
+func (ws *WebServer) handleRecording(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, ws.App.RecordingStatus())
+}
+
+// POST включает запись; необязательный {"label": "..."} попадает в имена файлов
+func (ws *WebServer) handleRecordingStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	var req struct {
+		Label string `json:"label"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+	}
+	if err := ws.App.StartRecording(req.Label); err != nil {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, ws.App.RecordingStatus())
+}
+
+func (ws *WebServer) handleRecordingStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	ws.App.StopRecording()
+	respondJSON(w, http.StatusOK, ws.App.RecordingStatus())
+}
+
 func respondJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
 	w.Header().Set("Content-Type", "application/json")